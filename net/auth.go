@@ -0,0 +1,145 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrLoginUnsupported 认证方式使用固定凭证，不能重新登录
+var ErrLoginUnsupported = errors.New("固定凭证不能重新登录")
+
+// Authenticator 请求认证方式，Apply 为需要认证的请求添加认证信息，
+// token 失效时 send 先调用 Refresh，失败后调用 Login，成功后重放原请求
+type Authenticator interface {
+	Apply(n *Client, req *http.Request) error
+	Login(ctx context.Context, n *Client) error
+	Refresh(ctx context.Context, n *Client) error
+}
+
+// tokenAuth 通过 LoginUrl/RefreshUrl 获取 token，Token 不为空时使用固定 token
+type tokenAuth struct {
+	Token string
+}
+
+func (a *tokenAuth) token(n *Client) string {
+	if a.Token != "" {
+		return a.Token
+	}
+	return n.TokenClient.GetCacheToken()
+}
+
+func (a *tokenAuth) Login(ctx context.Context, n *Client) error {
+	if a.Token != "" {
+		return ErrLoginUnsupported
+	}
+	_, err := n.GetTokenContext(ctx)
+	return err
+}
+
+func (a *tokenAuth) Refresh(ctx context.Context, n *Client) error {
+	if a.Token != "" {
+		return ErrLoginUnsupported
+	}
+	if n.Config.RefreshUrl == "" {
+		return errors.New("RefreshUrl is empty")
+	}
+	_, err := n.RfreshTokenContext(ctx)
+	return err
+}
+
+// XTokenAuth 默认认证方式，token 放在 X-Token 请求头，并带上登录返回的 PHPSESSID，没有 Appid 时不添加，
+// 启用 CookieJar 时 PHPSESSID 由 CookieJar 带上
+type XTokenAuth struct {
+	tokenAuth
+}
+
+func (a *XTokenAuth) Apply(n *Client, req *http.Request) error {
+	if n.Config.Appid == "" {
+		return nil
+	}
+	req.Header.Set("X-Token", a.token(n))
+	if n.Jar() != nil {
+		return nil
+	}
+	phpSessionId := n.TokenClient.GetSessionId()
+	if phpSessionId != nil {
+		req.AddCookie(phpSessionId)
+	}
+	return nil
+}
+
+// BearerAuth token 放在 Authorization: Bearer 请求头
+type BearerAuth struct {
+	tokenAuth
+}
+
+// NewBearerAuth token 为空时通过 LoginUrl 登录获取
+func NewBearerAuth(token string) *BearerAuth {
+	return &BearerAuth{tokenAuth{Token: token}}
+}
+
+func (a *BearerAuth) Apply(n *Client, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.token(n))
+	return nil
+}
+
+// HeaderAuth token 放在自定义请求头
+type HeaderAuth struct {
+	tokenAuth
+	Name string
+}
+
+// NewHeaderAuth token 为空时通过 LoginUrl 登录获取
+func NewHeaderAuth(name, token string) *HeaderAuth {
+	return &HeaderAuth{tokenAuth: tokenAuth{Token: token}, Name: name}
+}
+
+func (a *HeaderAuth) Apply(n *Client, req *http.Request) error {
+	req.Header.Set(a.Name, a.token(n))
+	return nil
+}
+
+// QueryAuth token 放在 url 参数中
+type QueryAuth struct {
+	tokenAuth
+	Param string
+}
+
+// NewQueryAuth token 为空时通过 LoginUrl 登录获取
+func NewQueryAuth(param, token string) *QueryAuth {
+	return &QueryAuth{tokenAuth: tokenAuth{Token: token}, Param: param}
+}
+
+func (a *QueryAuth) Apply(n *Client, req *http.Request) error {
+	query := req.URL.Query()
+	query.Set(a.Param, a.token(n))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// BasicAuth http Basic 认证，使用固定用户名和密码
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Apply(n *Client, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+func (a *BasicAuth) Login(ctx context.Context, n *Client) error {
+	return ErrLoginUnsupported
+}
+
+func (a *BasicAuth) Refresh(ctx context.Context, n *Client) error {
+	return ErrLoginUnsupported
+}
+
+func (n *Client) authenticator() Authenticator {
+	if n.Config.Auth != nil {
+		return n.Config.Auth
+	}
+	return &XTokenAuth{}
+}
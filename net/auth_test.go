@@ -0,0 +1,82 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_Authenticator(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":"%s|%s|%s|%s:%s"}`,
+			r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"), r.URL.Query().Get("access_token"), user, pass)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		auth Authenticator
+		want string
+	}{
+		{name: "Bearer", auth: NewBearerAuth("abc"), want: "Bearer abc|||:"},
+		{name: "Header", auth: NewHeaderAuth("X-Api-Key", "abc"), want: "|abc||:"},
+		{name: "Query", auth: NewQueryAuth("access_token", "abc"), want: "||abc|:"},
+		{name: "Basic", auth: &BasicAuth{Username: "u", Password: "p"}, want: "Basic dTpw|||u:p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(&Config{Auth: tt.auth})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sr := &ServerResponse{FullPath: ts.URL + "/report?a=1", Auth: true, ResponseInfo: &ResponseInfo{}}
+			if _, err := client.GetNet(sr); err != nil {
+				t.Fatalf("GetNet() error = %v", err)
+			}
+			if sr.ResponseInfo.Data != tt.want {
+				t.Errorf("GetNet() data = %v, want %s", sr.ResponseInfo.Data, tt.want)
+			}
+		})
+	}
+}
+
+func Test_BearerAuthLogin(t *testing.T) {
+	var logins int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":{"AccessToken":"token-%d"}}`, logins)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client, err := New(&Config{Appid: "bearer", LoginUrl: ts.URL + "/login", TokenDriver: "local", Auth: NewBearerAuth("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/report", Auth: true}); err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if logins != 1 {
+		t.Errorf("logins = %d, want 1", logins)
+	}
+
+	static, err := New(&Config{Auth: &BasicAuth{Username: "u", Password: "p"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = static.GetNet(&ServerResponse{FullPath: ts.URL + "/report", Auth: true})
+	if !errors.Is(err, ErrLoginUnsupported) {
+		t.Errorf("GetNet() with BasicAuth error = %v, want ErrLoginUnsupported", err)
+	}
+}
@@ -0,0 +1,331 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed Batcher 已关闭，不再接收新的上报
+var ErrBatcherClosed = errors.New("batcher 已关闭")
+
+// BatchPolicy 合并上报，条数，字节数或等待时间任一达到时把积累的上报作为一个 POST 发送，
+// 上报按 json 数组放在表单字段 Field 中，例如 fault_data=[{...},{...}]
+type BatchPolicy struct {
+	FullPath   string        // 上报地址
+	Field      string        // 表单字段名
+	Auth       bool          // 是否需要 token
+	MaxItems   int           // 每次最多发送的条数，默认 100
+	MaxBytes   int           // 每次最多发送的 json 字节数，默认 64KB，单条超出时单独发送
+	MaxWait    time.Duration // 第一条上报最多等待多久发送，发送失败后也按此间隔重试，默认 5 秒
+	MaxRetries int           // 平台拒绝的上报最多重新发送的次数，默认 3，网络错误不计入
+
+	// Failed 从返回的 data 中读取发送失败的上报序号，这些上报重新排队，为空时整批成功
+	Failed func(data json.RawMessage) []int
+	// OnDrop 超过重试次数或关闭时未发送的上报
+	OnDrop func(items []json.RawMessage, err error)
+}
+
+func (p *BatchPolicy) maxItems() int {
+	if p.MaxItems <= 0 {
+		return 100
+	}
+	return p.MaxItems
+}
+
+func (p *BatchPolicy) maxBytes() int {
+	if p.MaxBytes <= 0 {
+		return 64 << 10
+	}
+	return p.MaxBytes
+}
+
+func (p *BatchPolicy) maxWait() time.Duration {
+	if p.MaxWait <= 0 {
+		return 5 * time.Second
+	}
+	return p.MaxWait
+}
+
+func (p *BatchPolicy) maxRetries() int {
+	if p.MaxRetries <= 0 {
+		return 3
+	}
+	return p.MaxRetries
+}
+
+type batchItem struct {
+	data     json.RawMessage
+	added    time.Time // Add 的时间，重新排队时不变
+	attempts int       // 平台拒绝的次数
+}
+
+// Batcher 合并上报，后台按 BatchPolicy 发送，同时只有一个批次在发送，失败的上报排回队首保持顺序
+type Batcher struct {
+	client *Client
+	p      *BatchPolicy
+
+	mu      sync.Mutex
+	pending []*batchItem
+	bytes   int
+	retryAt time.Time // 发送失败后下次发送的时间
+	closed  bool
+
+	sending sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewBatcher 创建 Batcher 并开始后台发送，使用后调用 Close
+func NewBatcher(client *Client, p *BatchPolicy) (*Batcher, error) {
+	if p.FullPath == "" || p.Field == "" {
+		return nil, errors.New("batch FullPath and Field must be set")
+	}
+	b := &Batcher{
+		client:  client,
+		p:       p,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go b.loop()
+	return b, nil
+}
+
+// Add 添加一条上报，item 按 json 编码
+func (b *Batcher) Add(item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+	b.pending = append(b.pending, &batchItem{data: data, added: time.Now()})
+	b.bytes += len(data)
+	b.mu.Unlock()
+
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending 未发送的上报条数
+func (b *Batcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Flush 立即发送所有未发送的上报，失败的上报留在队列中并返回错误
+func (b *Batcher) Flush(ctx context.Context) error {
+	for b.Pending() > 0 {
+		if err := b.flushOnce(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 不再接收新的上报，停止后台发送后继续发送剩余的上报，失败时按 MaxWait 重试，
+// 直到全部发送或 ctx 结束，ctx 结束时剩余的上报交给 OnDrop
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+	close(b.done)
+	<-b.stopped
+
+	for {
+		err := b.Flush(ctx)
+		if err == nil {
+			return nil
+		}
+		t := time.NewTimer(b.p.maxWait())
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			b.mu.Lock()
+			items := b.take(len(b.pending), 0)
+			b.mu.Unlock()
+			err = fmt.Errorf("%d items not sent: %w", len(items), ctx.Err())
+			b.drop(items, err)
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// loop 条数或字节数达到时立即发送，否则等到最早一条上报超过 MaxWait
+func (b *Batcher) loop() {
+	defer close(b.stopped)
+	for {
+		wait, ok := b.nextFlush()
+		if ok && wait <= 0 {
+			_ = b.flushOnce(context.Background())
+			continue
+		}
+		var t *time.Timer
+		var timer <-chan time.Time
+		if ok {
+			t = time.NewTimer(wait)
+			timer = t.C
+		}
+		select {
+		case <-b.done:
+		case <-b.kick:
+		case <-timer:
+		}
+		if t != nil {
+			t.Stop()
+		}
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+	}
+}
+
+// nextFlush 距离下次发送的时间，没有未发送的上报时 ok 为 false
+func (b *Batcher) nextFlush() (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) == 0 {
+		return 0, false
+	}
+	now := time.Now()
+	wait = b.pending[0].added.Add(b.p.maxWait()).Sub(now)
+	if len(b.pending) >= b.p.maxItems() || b.bytes >= b.p.maxBytes() {
+		wait = 0
+	}
+	if retry := b.retryAt.Sub(now); retry > wait {
+		wait = retry
+	}
+	return wait, true
+}
+
+// take 取出最多 max 条，总字节数不超过 maxBytes 的上报，至少取一条，调用时需持有 mu
+func (b *Batcher) take(max, maxBytes int) []*batchItem {
+	n, size := 0, 0
+	for n < len(b.pending) && n < max {
+		if n > 0 && maxBytes > 0 && size+len(b.pending[n].data) > maxBytes {
+			break
+		}
+		size += len(b.pending[n].data)
+		n++
+	}
+	items := b.pending[:n:n]
+	b.pending = b.pending[n:]
+	b.bytes -= size
+	return items
+}
+
+// requeue 失败的上报排回队首，调用时需持有 mu
+func (b *Batcher) requeue(items []*batchItem) {
+	if len(items) == 0 {
+		return
+	}
+	pending := make([]*batchItem, 0, len(items)+len(b.pending))
+	pending = append(pending, items...)
+	b.pending = append(pending, b.pending...)
+	for _, item := range items {
+		b.bytes += len(item.data)
+	}
+}
+
+// flushOnce 发送一个批次，平台不可达时整批排回队首，平台拒绝或 Failed 返回的上报增加重试次数后排回队首
+func (b *Batcher) flushOnce(ctx context.Context) error {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+
+	b.mu.Lock()
+	items := b.take(b.p.maxItems(), b.p.maxBytes())
+	b.mu.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+
+	data := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		data[i] = item.data
+	}
+	array, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	sr := &ServerResponse{FullPath: b.p.FullPath, Auth: b.p.Auth, ResponseInfo: &ResponseInfo{}}
+	_, err = b.client.POSTNetContext(ctx, sr, url.Values{b.p.Field: {string(array)}}.Encode())
+
+	var failed []*batchItem
+	switch {
+	case errors.Is(err, ErrQueued):
+		// 已写入离线队列，由离线队列重新发送
+		err = nil
+	case err != nil && queueable(err):
+		b.mu.Lock()
+		b.requeue(items)
+		b.retryAt = time.Now().Add(b.p.maxWait())
+		b.mu.Unlock()
+		return err
+	case err != nil:
+		failed = items
+	case b.p.Failed != nil:
+		// 平台可能重复返回同一个序号，每条上报只重新排队一次
+		seen := make(map[int]bool)
+		for _, i := range b.p.Failed(sr.ResponseInfo.RawData) {
+			if i >= 0 && i < len(items) && !seen[i] {
+				seen[i] = true
+				failed = append(failed, items[i])
+			}
+		}
+		if len(failed) > 0 {
+			err = fmt.Errorf("[POST] %s %d of %d items failed", b.p.FullPath, len(failed), len(items))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var retry, dropped []*batchItem
+	for _, item := range failed {
+		item.attempts++
+		if item.attempts > b.p.maxRetries() {
+			dropped = append(dropped, item)
+			continue
+		}
+		retry = append(retry, item)
+	}
+	b.mu.Lock()
+	b.requeue(retry)
+	if len(retry) > 0 {
+		b.retryAt = time.Now().Add(b.p.maxWait())
+	}
+	b.mu.Unlock()
+	b.drop(dropped, err)
+	return err
+}
+
+func (b *Batcher) drop(items []*batchItem, err error) {
+	if len(items) == 0 || b.p.OnDrop == nil {
+		return
+	}
+	data := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		data[i] = item.data
+	}
+	b.p.OnDrop(data, err)
+}
@@ -0,0 +1,174 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/nettest"
+)
+
+func newBatchClient(t *testing.T) (*nettest.Server, *Client) {
+	srv := nettest.NewServer()
+	t.Cleanup(srv.Close)
+	client, err := New(&Config{
+		Appid:       srv.Appid,
+		LoginUrl:    srv.LoginURL(),
+		LoginData:   srv.LoginData(),
+		TokenDriver: "local",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+// batchItems 每次上报中 fault_data 的内容
+func batchItems(srv *nettest.Server) [][]int {
+	var batches [][]int
+	for _, report := range srv.Reports() {
+		var items []int
+		_ = json.Unmarshal([]byte(report.Form.Get("fault_data")), &items)
+		batches = append(batches, items)
+	}
+	return batches
+}
+
+func waitReports(t *testing.T, srv *nettest.Server, n int) [][]int {
+	deadline := time.Now().Add(2 * time.Second)
+	for len(srv.Reports()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("reports = %v, want %d", batchItems(srv), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return batchItems(srv)
+}
+
+func Test_Batcher(t *testing.T) {
+	srv, client := newBatchClient(t)
+	b, err := NewBatcher(client, &BatchPolicy{FullPath: srv.ReportURL("service"), Field: "fault_data", Auth: true, MaxItems: 3, MaxWait: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(context.Background())
+
+	for i := 1; i <= 4; i++ {
+		b.Add(i)
+	}
+	got := waitReports(t, srv, 1)
+	if len(got[0]) != 3 || got[0][0] != 1 || got[0][2] != 3 {
+		t.Errorf("size flush = %v, want [1 2 3]", got[0])
+	}
+	got = waitReports(t, srv, 2)
+	if len(got[1]) != 1 || got[1][0] != 4 {
+		t.Errorf("time flush = %v, want [4]", got[1])
+	}
+}
+
+func Test_BatcherNextFlush(t *testing.T) {
+	b := &Batcher{p: &BatchPolicy{MaxItems: 2, MaxWait: time.Minute}}
+	added := time.Now().Add(-50 * time.Second)
+	for i := 0; i < 3; i++ {
+		b.pending = append(b.pending, &batchItem{data: json.RawMessage("1"), added: added})
+	}
+	b.take(b.p.maxItems(), 0)
+
+	// 剩下的上报按自己加入的时间计算，不会再等一个 MaxWait
+	if wait, ok := b.nextFlush(); !ok || wait > 10*time.Second {
+		t.Errorf("nextFlush() = %s, %v, want about 10s", wait, ok)
+	}
+}
+
+func Test_BatcherMaxBytes(t *testing.T) {
+	srv, client := newBatchClient(t)
+	b, err := NewBatcher(client, &BatchPolicy{FullPath: srv.ReportURL("service"), Field: "fault_data", Auth: true, MaxBytes: 10, MaxWait: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []int{1000, 2000, 30000} {
+		b.Add(item)
+	}
+	got := waitReports(t, srv, 1)
+	if len(got[0]) != 2 {
+		t.Errorf("byte flush = %v, want [1000 2000]", got[0])
+	}
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := batchItems(srv); len(got) != 2 || got[1][0] != 30000 {
+		t.Errorf("Close() flush = %v, want [30000]", got)
+	}
+	if err := b.Add(1); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("Add() after Close error = %v, want ErrBatcherClosed", err)
+	}
+}
+
+func Test_BatcherPartialFailure(t *testing.T) {
+	srv, client := newBatchClient(t)
+	// 登录后第一次上报返回第 2 条失败，序号重复时只重新发送一次
+	srv.Script(nettest.ReportPath+"service", nettest.Response{Code: 401, Message: "login again"}, nettest.Response{Data: map[string][]int{"failed": {1, 1}}})
+	var dropped []json.RawMessage
+	b, err := NewBatcher(client, &BatchPolicy{
+		FullPath: srv.ReportURL("service"),
+		Field:    "fault_data",
+		Auth:     true,
+		MaxItems: 3,
+		MaxWait:  20 * time.Millisecond,
+		Failed: func(data json.RawMessage) []int {
+			var resp struct{ Failed []int }
+			_ = json.Unmarshal(data, &resp)
+			return resp.Failed
+		},
+		OnDrop: func(items []json.RawMessage, err error) {
+			dropped = append(dropped, items...)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Add(1)
+	b.Add(2)
+	b.Add(3)
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// 脚本响应不校验 token，不会记录到 Reports
+	got := batchItems(srv)
+	if len(got) != 1 || len(got[0]) != 1 || got[0][0] != 2 {
+		t.Errorf("retried = %v, want [2]", got)
+	}
+	if len(dropped) != 0 {
+		t.Errorf("dropped = %s, want none", dropped)
+	}
+}
+
+func Test_BatcherCloseUnreachable(t *testing.T) {
+	_, client := newBatchClient(t)
+	closed := nettest.NewServer()
+	closed.Close()
+	var dropped []json.RawMessage
+	b, err := NewBatcher(client, &BatchPolicy{
+		FullPath: closed.ReportURL("service"),
+		Field:    "fault_data",
+		MaxWait:  20 * time.Millisecond,
+		OnDrop: func(items []json.RawMessage, err error) {
+			dropped = append(dropped, items...)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Add(1)
+	b.Add(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want DeadlineExceeded", err)
+	}
+	if len(dropped) != 2 || b.Pending() != 0 {
+		t.Errorf("dropped = %s pending = %d, want 2 dropped", dropped, b.Pending())
+	}
+}
@@ -0,0 +1,143 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 目标主机熔断中，请求没有发送
+var ErrCircuitOpen = errors.New("熔断中，服务暂不可用")
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 正常
+	StateOpen                         // 熔断，请求直接返回 ErrCircuitOpen
+	StateHalfOpen                     // 冷却结束，允许少量请求探测
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerPolicy 按目标主机熔断，网络错误，超时和 5xx 记为失败
+type BreakerPolicy struct {
+	FailureThreshold int           // 连续失败次数达到后熔断
+	CoolDown         time.Duration // 熔断后等待多久进入半开状态
+	HalfOpenRequests int           // 半开状态同时允许的探测请求数，默认 1
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// allow 判断是否允许发送请求，冷却结束时进入半开状态
+func (b *breaker) allow(p *BreakerPolicy, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if now.Sub(b.openedAt) < p.CoolDown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probes = 0
+	}
+	if b.state == StateHalfOpen {
+		limit := p.HalfOpenRequests
+		if limit < 1 {
+			limit = 1
+		}
+		if b.probes >= limit {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// done 记录请求结果，ignore 为 true 时只释放半开状态的探测名额
+func (b *breaker) done(p *BreakerPolicy, now time.Time, failed, ignore bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	if ignore {
+		return
+	}
+	if !failed {
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || (p.FailureThreshold > 0 && b.failures >= p.FailureThreshold) {
+		b.state = StateOpen
+		b.openedAt = now
+	}
+}
+
+func (b *breaker) current(p *BreakerPolicy, now time.Time) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && now.Sub(b.openedAt) >= p.CoolDown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+func (n *Client) breaker(host string) *breaker {
+	b, _ := n.breakers.LoadOrStore(host, &breaker{})
+	return b.(*breaker)
+}
+
+// breakerInterceptor 按 Config.Breaker 熔断
+func (n *Client) breakerInterceptor(call *Call, next Handler) error {
+	p := n.Config.Breaker
+	req := call.Request
+	b := n.breaker(req.URL.Host)
+	if !b.allow(p, time.Now()) {
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, ErrCircuitOpen)
+	}
+
+	err := next(call)
+	failed := call.Response == nil || call.Response.StatusCode >= http.StatusInternalServerError
+	// 调用方主动取消的请求不代表主机不可用
+	ignore := call.Response == nil && errors.Is(req.Context().Err(), context.Canceled)
+	b.done(p, time.Now(), failed, ignore)
+	return err
+}
+
+// CircuitStates 各目标主机的熔断器状态，没有开启熔断时返回空
+func (n *Client) CircuitStates() map[string]BreakerState {
+	states := map[string]BreakerState{}
+	if n.Config.Breaker == nil {
+		return states
+	}
+	now := time.Now()
+	n.breakers.Range(func(key, value interface{}) bool {
+		states[key.(string)] = value.(*breaker).current(n.Config.Breaker, now)
+		return true
+	})
+	return states
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func Test_Breaker(t *testing.T) {
+	var hits int
+	healthy := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	client := &Client{Config: &Config{Breaker: &BreakerPolicy{FailureThreshold: 2, CoolDown: 50 * time.Millisecond}}}
+	sr := &ServerResponse{FullPath: ts.URL}
+	u, _ := url.Parse(ts.URL)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetNet(sr); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("GetNet() error = %v, want server error", err)
+		}
+	}
+	if state := client.CircuitStates()[u.Host]; state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+	if _, err := client.GetNet(sr); !errors.Is(err, ErrCircuitOpen) || hits != 2 {
+		t.Fatalf("GetNet() error = %v hits = %d, want ErrCircuitOpen without request", err, hits)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if state := client.CircuitStates()[u.Host]; state != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", state)
+	}
+	healthy = true
+	if _, err := client.GetNet(sr); err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if state := client.CircuitStates()[u.Host]; state != StateClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
@@ -0,0 +1,173 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/patrickmn/go-cache"
+)
+
+// CacheEntry 缓存的返回内容
+type CacheEntry struct {
+	Status       int       `json:"status"`
+	Body         []byte    `json:"body"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"` // 在此之前直接使用缓存，之后使用 ETag/Last-Modified 重新校验
+}
+
+// Cache GET 请求缓存存储
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry, expiration time.Duration)
+}
+
+// CachePolicy GetNet 请求缓存，只缓存成功的返回内容
+type CachePolicy struct {
+	Store  Cache         // 缓存存储，为空使用内存缓存
+	TTL    time.Duration // 缓存有效期，有效期内不发送请求，0 表示每次都重新校验
+	MaxAge time.Duration // 缓存保存时间，用于 ETag/Last-Modified 重新校验，默认 24 小时
+}
+
+func (p *CachePolicy) maxAge() time.Duration {
+	if p.MaxAge > p.TTL {
+		return p.MaxAge
+	}
+	if p.MaxAge <= 0 && p.TTL < 24*time.Hour {
+		return 24 * time.Hour
+	}
+	return p.TTL
+}
+
+// MemoryCache 基于 go-cache 的内存缓存
+type MemoryCache struct {
+	ca *cache.Cache
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{ca: cache.New(24*time.Hour, 10*time.Minute)}
+}
+
+func (mc *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	foo, found := mc.ca.Get(key)
+	if !found {
+		return nil, false
+	}
+	return foo.(*CacheEntry), true
+}
+
+func (mc *MemoryCache) Set(key string, entry *CacheEntry, expiration time.Duration) {
+	mc.ca.Set(key, entry, expiration)
+}
+
+// RedisCache 基于 redis 的缓存，多个进程共享
+type RedisCache struct {
+	ca     *redis.Client
+	prefix string
+}
+
+// NewRedisCache 按 options 创建独立的 redis 连接，key 添加 prefix 前缀
+func NewRedisCache(options *redis.Options, prefix string) *RedisCache {
+	return &RedisCache{ca: redis.NewClient(options), prefix: prefix}
+}
+
+func (rc *RedisCache) Get(key string) (*CacheEntry, bool) {
+	b, err := rc.ca.Get(context.Background(), rc.prefix+key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	entry := &CacheEntry{}
+	if json.Unmarshal(b, entry) != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (rc *RedisCache) Set(key string, entry *CacheEntry, expiration time.Duration) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	rc.ca.Set(context.Background(), rc.prefix+key, b, expiration)
+}
+
+func (n *Client) cacheStore() Cache {
+	if n.Config.Cache.Store != nil {
+		return n.Config.Cache.Store
+	}
+	n.cacheOnce.Do(func() {
+		n.memoryCache = NewMemoryCache()
+	})
+	return n.memoryCache
+}
+
+// cacheInterceptor 按 Config.Cache 缓存 GetNet 请求，过期后使用 If-None-Match/If-Modified-Since 重新校验
+func (n *Client) cacheInterceptor(call *Call, next Handler) error {
+	req := call.Request
+	if req.Method != http.MethodGet || !call.cache || !call.decode {
+		return next(call)
+	}
+	// 登录和刷新 token 必须每次请求平台
+	if u := req.URL.String(); u == n.Config.LoginUrl || u == n.Config.RefreshUrl {
+		return next(call)
+	}
+
+	p := n.Config.Cache
+	store := n.cacheStore()
+	key := n.Config.Appid + "|" + req.URL.String()
+	entry, found := store.Get(key)
+	if found && time.Now().Before(entry.Expires) {
+		return n.fromCache(call, entry)
+	}
+	if found {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	err := next(call)
+	if err != nil {
+		return err
+	}
+	if call.StatusCode() == http.StatusNotModified && found {
+		// Store 返回的 entry 可能被其他请求同时读取，修改副本
+		renewed := *entry
+		renewed.Expires = time.Now().Add(p.TTL)
+		store.Set(key, &renewed, p.maxAge())
+		return n.fromCache(call, &renewed)
+	}
+	if call.Result == nil || call.Result.Outcome != OutcomeSuccess {
+		return nil
+	}
+
+	entry = &CacheEntry{
+		Status:       call.StatusCode(),
+		Body:         call.Body,
+		ETag:         call.Response.Header.Get("ETag"),
+		LastModified: call.Response.Header.Get("Last-Modified"),
+		Expires:      time.Now().Add(p.TTL),
+	}
+	if p.TTL > 0 || entry.ETag != "" || entry.LastModified != "" {
+		store.Set(key, entry, p.maxAge())
+	}
+	return nil
+}
+
+// fromCache 使用缓存内容作为返回
+func (n *Client) fromCache(call *Call, entry *CacheEntry) error {
+	call.Response = &http.Response{
+		Status:     http.StatusText(entry.Status),
+		StatusCode: entry.Status,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    call.Request,
+	}
+	call.Body = entry.Body
+	return n.decode(call)
+}
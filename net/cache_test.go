@@ -0,0 +1,122 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/token"
+	"github.com/go-redis/redis/v8"
+)
+
+func Test_Cache(t *testing.T) {
+	var hits, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":["restful"]}`)
+	}))
+	defer ts.Close()
+
+	t.Run("TTL", func(t *testing.T) {
+		hits, notModified = 0, 0
+		client := &Client{Config: &Config{Cache: &CachePolicy{TTL: time.Minute}}}
+		for i := 0; i < 3; i++ {
+			sr := &ServerResponse{FullPath: ts.URL + "/ttl", ResponseInfo: &ResponseInfo{}}
+			if _, err := client.GetNet(sr); err != nil {
+				t.Fatalf("GetNet() error = %v", err)
+			}
+			if fmt.Sprint(sr.ResponseInfo.Data) != "[restful]" {
+				t.Errorf("GetNet() data = %v", sr.ResponseInfo.Data)
+			}
+		}
+		if hits != 1 {
+			t.Errorf("hits = %d, want 1", hits)
+		}
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		hits, notModified = 0, 0
+		client := &Client{Config: &Config{Cache: &CachePolicy{Store: NewMemoryCache()}}}
+		for i := 0; i < 3; i++ {
+			sr := &ServerResponse{FullPath: ts.URL + "/etag", ResponseInfo: &ResponseInfo{}}
+			if _, err := client.GetNet(sr); err != nil {
+				t.Fatalf("GetNet() error = %v", err)
+			}
+			if fmt.Sprint(sr.ResponseInfo.Data) != "[restful]" {
+				t.Errorf("GetNet() data = %v", sr.ResponseInfo.Data)
+			}
+		}
+		if hits != 3 || notModified != 2 {
+			t.Errorf("hits = %d notModified = %d, want 3 and 2", hits, notModified)
+		}
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		refreshes := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			refreshes++
+			fmt.Fprintf(w, `{"code":200,"message":"ok","data":{"AccessToken":"token-%d"}}`, refreshes)
+		}))
+		defer ts.Close()
+
+		client := &Client{
+			Config:      &Config{Appid: "cache", RefreshUrl: ts.URL + "/refresh", Cache: &CachePolicy{TTL: time.Minute}},
+			TokenClient: &token.LocalClient{AppID: "cache"},
+		}
+		client.TokenClient.GetCache()
+		for i := 1; i <= 2; i++ {
+			got, err := client.RfreshToken()
+			if want := fmt.Sprintf("token-%d", i); err != nil || got != want {
+				t.Errorf("RfreshToken() = %q, %v, want %s", got, err, want)
+			}
+		}
+	})
+}
+
+func Test_CacheConcurrentRevalidate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":["restful"]}`)
+	}))
+	defer ts.Close()
+
+	client := &Client{Config: &Config{Cache: &CachePolicy{}}}
+	if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sr := &ServerResponse{FullPath: ts.URL, ResponseInfo: &ResponseInfo{}}
+			if _, err := client.GetNet(sr); err != nil || fmt.Sprint(sr.ResponseInfo.Data) != "[restful]" {
+				t.Errorf("GetNet() = %v, %v", sr.ResponseInfo.Data, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_NewRedisCacheOptions(t *testing.T) {
+	a := NewRedisCache(&redis.Options{Addr: "127.0.0.1:6379", DB: 1}, "a:")
+	b := NewRedisCache(&redis.Options{Addr: "127.0.0.1:6380", DB: 2}, "b:")
+	defer a.ca.Close()
+	defer b.ca.Close()
+	if a.ca == b.ca || b.ca.Options().Addr != "127.0.0.1:6380" || b.ca.Options().DB != 2 {
+		t.Errorf("NewRedisCache() options = %+v, want its own client", b.ca.Options())
+	}
+}
@@ -0,0 +1,254 @@
+package net
+
+import (
+	"encoding/json"
+	stdnet "net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chindeo/pkg/net/token"
+)
+
+// jarCookie 持久化的 cookie，json 字段顺序固定，Expires 为 unix 秒，0 表示会话 cookie
+type jarCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	HostOnly bool   `json:"host_only,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
+	Expires  int64  `json:"expires,omitempty"`
+}
+
+func (c *jarCookie) key() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+func (c *jarCookie) expired(now time.Time) bool {
+	return c.Expires != 0 && c.Expires <= now.Unix()
+}
+
+// domainMatch host 与 cookie 域名匹配，HostOnly 或 host 是 IP 地址时必须相同
+func (c *jarCookie) domainMatch(host string) bool {
+	if host == c.Domain {
+		return true
+	}
+	return !c.HostOnly && !isIP(host) && strings.HasSuffix(host, "."+c.Domain)
+}
+
+// cookieDomain 解析 Domain 属性，IP 地址和不带点的域名（例如 com）只能与 host 相同，作为 HostOnly cookie
+func cookieDomain(host, domain string) (d string, hostOnly, ok bool) {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	if isIP(domain) || !strings.Contains(domain, ".") {
+		return host, true, domain == host
+	}
+	c := &jarCookie{Domain: domain}
+	return domain, false, c.domainMatch(host)
+}
+
+func isIP(host string) bool {
+	return stdnet.ParseIP(host) != nil
+}
+
+// pathMatch 请求路径与 cookie 路径匹配，规则见 RFC 6265 5.1.4
+func (c *jarCookie) pathMatch(path string) bool {
+	if path == c.Path {
+		return true
+	}
+	if !strings.HasPrefix(path, c.Path) {
+		return false
+	}
+	return strings.HasSuffix(c.Path, "/") || path[len(c.Path)] == '/'
+}
+
+// CookieJar 实现 http.CookieJar，按域名、路径和过期时间管理 cookie，
+// store 实现 token.CookieStore 时每次变更都通过 token 驱动保存，重启后继续使用
+type CookieJar struct {
+	mu      sync.Mutex
+	store   token.CookieStore
+	cookies map[string]*jarCookie
+	now     func() time.Time
+}
+
+// NewCookieJar store 没有实现 token.CookieStore 时只保存在内存，否则从 store 读取已保存的 cookie
+func NewCookieJar(store token.TokenClient) *CookieJar {
+	jar := &CookieJar{cookies: map[string]*jarCookie{}, now: time.Now}
+	if cs, ok := store.(token.CookieStore); ok {
+		jar.store = cs
+		if data := cs.GetCookies(); len(data) > 0 {
+			_ = jar.UnmarshalJSON(data)
+		}
+	}
+	return jar
+}
+
+// SetCookies 保存响应的 cookie，MaxAge < 0 或已过期的 cookie 删除，域名不匹配的 cookie 忽略
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u)
+	if host == "" {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	changed := false
+	for _, cookie := range cookies {
+		c := &jarCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		if cookie.Domain == "" {
+			c.Domain, c.HostOnly = host, true
+		} else {
+			var ok bool
+			c.Domain, c.HostOnly, ok = cookieDomain(host, cookie.Domain)
+			if !ok {
+				continue
+			}
+		}
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = defaultPath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge < 0:
+			c.Expires = now.Unix()
+		case cookie.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+		case !cookie.Expires.IsZero():
+			c.Expires = cookie.Expires.Unix()
+		}
+		if c.expired(now) {
+			if _, ok := j.cookies[c.key()]; ok {
+				delete(j.cookies, c.key())
+				changed = true
+			}
+			continue
+		}
+		j.cookies[c.key()] = c
+		changed = true
+	}
+	if changed {
+		j.save()
+	}
+}
+
+// Cookies 返回请求 u 需要带上的 cookie，路径长的排在前面
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u)
+	if host == "" {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	var matched []*jarCookie
+	for key, c := range j.cookies {
+		if c.expired(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		if !c.domainMatch(host) || !c.pathMatch(path) || (c.Secure && u.Scheme != "https") {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].Path) != len(matched[b].Path) {
+			return len(matched[a].Path) > len(matched[b].Path)
+		}
+		return matched[a].Name < matched[b].Name
+	})
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, c := range matched {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// MarshalJSON 按域名、路径、名称排序输出未过期的 cookie，相同内容输出相同
+func (j *CookieJar) MarshalJSON() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.marshal()
+}
+
+// UnmarshalJSON 替换为 MarshalJSON 输出的 cookie，跳过已过期的 cookie
+func (j *CookieJar) UnmarshalJSON(data []byte) error {
+	var list []*jarCookie
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	j.cookies = make(map[string]*jarCookie, len(list))
+	for _, c := range list {
+		if c.Name == "" || c.Domain == "" || c.expired(now) {
+			continue
+		}
+		j.cookies[c.key()] = c
+	}
+	return nil
+}
+
+func (j *CookieJar) marshal() ([]byte, error) {
+	now := j.now()
+	list := make([]*jarCookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].key() < list[b].key()
+	})
+	return json.Marshal(list)
+}
+
+func (j *CookieJar) save() {
+	if j.store == nil {
+		return
+	}
+	data, err := j.marshal()
+	if err != nil {
+		return
+	}
+	j.store.SetCookies(data)
+}
+
+func canonicalHost(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// defaultPath 未指定 Path 时使用请求路径的目录，规则见 RFC 6265 5.1.4
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// Jar 返回 Config.CookieJar 启用时的 CookieJar，未启用时返回 nil
+func (n *Client) Jar() *CookieJar {
+	if n.httpClient == nil {
+		return nil
+	}
+	jar, _ := n.httpClient.Jar.(*CookieJar)
+	return jar
+}
@@ -0,0 +1,162 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/token"
+)
+
+func cookieNames(cookies []*http.Cookie) string {
+	var names []string
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	return strings.Join(names, ";")
+}
+
+func Test_CookieJar(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	jar := NewCookieJar(nil)
+	jar.now = func() time.Time { return now }
+
+	u, _ := url.Parse("http://api.example.com/v1/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "v1", Value: "3", Path: "/v1"},
+		{Name: "secure", Value: "4", Path: "/", Secure: true},
+		{Name: "short", Value: "5", Path: "/", MaxAge: 60},
+		{Name: "other", Value: "6", Domain: "other.com"},
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "同一路径", url: "http://api.example.com/v1/report", want: "host=1;v1=3;domain=2;short=5"},
+		{name: "路径不匹配", url: "http://api.example.com/v2", want: "domain=2;short=5"},
+		{name: "路径前缀不是目录", url: "http://api.example.com/v10", want: "domain=2;short=5"},
+		{name: "https", url: "https://api.example.com/", want: "domain=2;secure=4;short=5"},
+		{name: "子域名", url: "http://www.example.com/v1", want: "domain=2"},
+		{name: "其他域名", url: "http://other.com/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := cookieNames(jar.Cookies(u)); got != tt.want {
+				t.Errorf("Cookies() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	now = now.Add(2 * time.Minute)
+	jar.SetCookies(u, []*http.Cookie{{Name: "host", MaxAge: -1}})
+	if got := cookieNames(jar.Cookies(u)); got != "v1=3;domain=2" {
+		t.Errorf("Cookies() after expiry = %s, want v1=3;domain=2", got)
+	}
+}
+
+func Test_CookieJarDomain(t *testing.T) {
+	jar := NewCookieJar(nil)
+	set := func(rawurl string, cookies ...*http.Cookie) {
+		u, _ := url.Parse(rawurl)
+		jar.SetCookies(u, cookies)
+	}
+	set("http://api.example.com/",
+		&http.Cookie{Name: "tld", Value: "1", Domain: "com", Path: "/"},
+		&http.Cookie{Name: "ip", Value: "2", Domain: "127.0.0.1", Path: "/"},
+	)
+	set("http://10.0.0.1/",
+		&http.Cookie{Name: "suffix", Value: "3", Domain: "0.0.1", Path: "/"},
+		&http.Cookie{Name: "exact", Value: "4", Domain: "10.0.0.1", Path: "/"},
+	)
+	set("http://localhost/", &http.Cookie{Name: "local", Value: "5", Domain: "localhost", Path: "/"})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://www.other.com/", want: ""},
+		{url: "http://127.0.0.1/", want: ""},
+		{url: "http://10.0.0.1/", want: "exact=4"},
+		{url: "http://110.0.0.1/", want: ""},
+		{url: "http://localhost/", want: "local=5"},
+		{url: "http://www.localhost/", want: ""},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := cookieNames(jar.Cookies(u)); got != tt.want {
+			t.Errorf("Cookies(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
+func Test_CookieJarPersist(t *testing.T) {
+	store := &token.LocalClient{AppID: "cookie"}
+	store.GetCache()
+
+	u, _ := url.Parse("http://api.example.com/")
+	jar := NewCookieJar(store)
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "b", Value: "2", Expires: time.Now().Add(time.Hour).Truncate(time.Second)},
+		{Name: "a", Value: "1", HttpOnly: true},
+	})
+	data, err := jar.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(store.GetCookies()) != string(data) {
+		t.Errorf("stored = %s, want %s", store.GetCookies(), data)
+	}
+	if !strings.HasPrefix(string(data), `[{"name":"a","value":"1","domain":"api.example.com","path":"/","host_only":true,"http_only":true}`) {
+		t.Errorf("MarshalJSON() = %s", data)
+	}
+
+	restored := NewCookieJar(store)
+	if got := cookieNames(restored.Cookies(u)); got != "a=1;b=2" {
+		t.Errorf("restored Cookies() = %s, want a=1;b=2", got)
+	}
+	again, _ := restored.MarshalJSON()
+	if string(again) != string(data) {
+		t.Errorf("MarshalJSON() not stable: %s != %s", again, data)
+	}
+}
+
+func Test_ClientCookieJar(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "sess", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "lb", Value: "node-1", Path: "/"})
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"token"}}`)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "token" {
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":"%s"}`, r.Header.Get("Cookie"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client, err := New(&Config{Appid: "jar", LoginUrl: ts.URL + "/login", TokenDriver: "local", CookieJar: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServerResponse{FullPath: ts.URL + "/report", Auth: true, ResponseInfo: &ResponseInfo{}}
+	if _, err := client.GetNet(sr); err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if sr.ResponseInfo.Data != "PHPSESSID=sess; lb=node-1" {
+		t.Errorf("GetNet() cookies = %v, want PHPSESSID=sess; lb=node-1", sr.ResponseInfo.Data)
+	}
+	if len(client.TokenClient.(token.CookieStore).GetCookies()) == 0 {
+		t.Errorf("cookies not persisted")
+	}
+}
@@ -0,0 +1,219 @@
+package net
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chindeo/pkg/logging"
+)
+
+// redacted 替换敏感内容
+const redacted = "***"
+
+// DebugPolicy 记录完整的请求和返回，包括方法，地址，请求头，内容和耗时，
+// AppSecret，token，cookie，认证请求头以及 HeaderAuth/QueryAuth 使用的请求头和 url 参数会被替换为 ***
+type DebugPolicy struct {
+	Logger        *logging.Logger // 为空时使用 logging.For(ctx)
+	MaxBody       int             // 记录的请求和返回内容最大字节数，默认 4096，小于 0 不记录内容
+	RedactHeaders []string        // 额外需要隐藏的请求头和返回头
+	RedactFields  []string        // 额外需要隐藏的表单，url 参数和 json 字段
+}
+
+var (
+	redactHeaders = []string{"Authorization", "Proxy-Authorization", "X-Token", "X-Signature"}
+	redactFields  = []string{"appsecret", "app_secret", "secret", "password", "pwd", "token", "x-token", "accesstoken", "access_token", "refresh_token"}
+)
+
+func (p *DebugPolicy) maxBody() int {
+	if p.MaxBody == 0 {
+		return 4096
+	}
+	return p.MaxBody
+}
+
+// debugPolicy 在 Config.Debug 的基础上隐藏当前 Authenticator 使用的请求头或 url 参数
+func (n *Client) debugPolicy() *DebugPolicy {
+	p := *n.Config.Debug
+	switch a := n.authenticator().(type) {
+	case *HeaderAuth:
+		p.RedactHeaders = append(p.RedactHeaders[:len(p.RedactHeaders):len(p.RedactHeaders)], a.Name)
+	case *QueryAuth:
+		p.RedactFields = append(p.RedactFields[:len(p.RedactFields):len(p.RedactFields)], a.Param)
+	}
+	return &p
+}
+
+// debugInterceptor 在签名之后记录实际发送的请求，重试时每次请求单独记录
+func (n *Client) debugInterceptor(call *Call, next Handler) error {
+	p := n.debugPolicy()
+	req := call.Request
+	reqBody := n.dumpRequestBody(req, p)
+
+	start := time.Now()
+	err := next(call)
+
+	fields := []interface{}{
+		"method", req.Method,
+		"url", n.redactURL(req.URL, p),
+		"request_headers", n.redactHeader(req.Header, p),
+		"request_body", reqBody,
+		"duration", time.Since(start),
+	}
+	if resp := call.Response; resp != nil {
+		fields = append(fields,
+			"status", resp.StatusCode,
+			"response_headers", n.redactHeader(resp.Header, p),
+		)
+		if call.readBody {
+			fields = append(fields, "response_body", n.redactBody(call.Body, resp.Header.Get("Content-Type"), p))
+		}
+	}
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+
+	logger := p.Logger
+	if logger == nil {
+		logger = logging.For(req.Context())
+	}
+	logger.Debugw("http dump", fields...)
+	return err
+}
+
+// dumpRequestBody 通过 GetBody 读取请求内容，流式上传的内容无法重复读取不记录
+func (n *Client) dumpRequestBody(req *http.Request, p *DebugPolicy) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody == nil {
+		return "<stream>"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	defer body.Close()
+	max := p.maxBody()
+	if max < 0 {
+		return ""
+	}
+	b, _ := io.ReadAll(io.LimitReader(body, int64(max)+1))
+	return n.redactBody(b, req.Header.Get("Content-Type"), p)
+}
+
+// redactBody 表单按字段名隐藏，其他内容隐藏敏感 json 字段，AppSecret 出现在任何位置都会隐藏
+func (n *Client) redactBody(b []byte, contentType string, p *DebugPolicy) string {
+	max := p.maxBody()
+	if max < 0 {
+		return ""
+	}
+	truncated := len(b) > max
+	if truncated {
+		b = b[:max]
+	}
+	s := string(b)
+	values, err := url.ParseQuery(s)
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") && err == nil {
+		s = redactValues(values, p)
+	} else {
+		s = jsonFieldPattern(p).ReplaceAllString(s, `"$1":"`+redacted+`"`)
+	}
+	if secret := n.Config.AppSecret; secret != "" {
+		s = strings.ReplaceAll(s, secret, redacted)
+		s = strings.ReplaceAll(s, url.QueryEscape(secret), redacted)
+	}
+	if truncated {
+		s += "...(truncated)"
+	}
+	return s
+}
+
+func (n *Client) redactURL(u *url.URL, p *DebugPolicy) string {
+	c := *u
+	c.User = nil
+	if c.RawQuery != "" {
+		if values, err := url.ParseQuery(c.RawQuery); err == nil {
+			c.RawQuery = redactValues(values, p)
+		}
+	}
+	return c.String()
+}
+
+// redactHeader 复制请求头并隐藏敏感内容，cookie 只保留名称
+func (n *Client) redactHeader(h http.Header, p *DebugPolicy) http.Header {
+	c := make(http.Header, len(h))
+	for key, values := range h {
+		for _, value := range values {
+			switch {
+			case key == "Cookie":
+				value = redactCookies(value)
+			case key == "Set-Cookie":
+				value = redactCookies(strings.SplitN(value, ";", 2)[0])
+			case matchName(key, redactHeaders, p.RedactHeaders):
+				value = redacted
+			}
+			c[key] = append(c[key], value)
+		}
+	}
+	return c
+}
+
+func redactCookies(value string) string {
+	parts := strings.Split(value, ";")
+	for i, part := range parts {
+		name := strings.SplitN(strings.TrimSpace(part), "=", 2)[0]
+		parts[i] = name + "=" + redacted
+	}
+	return strings.Join(parts, "; ")
+}
+
+// redactValues 按名称排序编码，隐藏的值不转义，便于阅读
+func redactValues(values url.Values, p *DebugPolicy) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		hide := matchName(key, redactFields, p.RedactFields)
+		for _, value := range values[key] {
+			if sb.Len() > 0 {
+				sb.WriteByte('&')
+			}
+			sb.WriteString(url.QueryEscape(key) + "=")
+			if hide {
+				sb.WriteString(redacted)
+			} else {
+				sb.WriteString(url.QueryEscape(value))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func matchName(name string, builtin, extra []string) bool {
+	for _, list := range [][]string{builtin, extra} {
+		for _, item := range list {
+			if strings.EqualFold(name, item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonFieldPattern 匹配敏感 json 字符串字段
+func jsonFieldPattern(p *DebugPolicy) *regexp.Regexp {
+	names := make([]string, 0, len(redactFields)+len(p.RedactFields))
+	for _, name := range append(append([]string{}, redactFields...), p.RedactFields...) {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	return regexp.MustCompile(`(?i)"(` + strings.Join(names, "|") + `)"\s*:\s*"[^"]*"`)
+}
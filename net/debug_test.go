@@ -0,0 +1,99 @@
+package net
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chindeo/pkg/logging"
+)
+
+func Test_Debug(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session-value", Path: "/"})
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"token-value"}}`)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "token-value" {
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"password":"pwd-value","name":"device"}}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	logger := logging.New()
+	logger.SetOutput(&buf)
+	client, err := New(&Config{
+		Appid:       "debug",
+		AppSecret:   "secret-value",
+		LoginUrl:    ts.URL + "/login",
+		LoginData:   "appid=debug&appsecret=secret-value&apptype=hospital",
+		TokenDriver: "local",
+		Debug:       &DebugPolicy{Logger: logger, RedactFields: []string{"device_sn"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &ServerResponse{FullPath: ts.URL + "/report?device_sn=sn-value&page=1", Auth: true}
+	if _, err := client.POSTNet(sr, "fault_data=1"); err != nil {
+		t.Fatalf("POSTNet() error = %v", err)
+	}
+
+	out := buf.String()
+	if got := strings.Count(out, "http dump"); got != 3 {
+		t.Errorf("dump count = %d, want 3\n%s", got, out)
+	}
+	for _, secret := range []string{"secret-value", "token-value", "session-value", "pwd-value", "sn-value"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("dump contains %s\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"appsecret=***", "apptype=hospital", "fault_data=1", "device_sn=***&page=1", "PHPSESSID=***", `\"AccessToken\":\"***\"`, `"X-Token":["***"]`, `\"name\":\"device\"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump does not contain %s\n%s", want, out)
+		}
+	}
+}
+
+func Test_DebugAuthNames(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	for _, auth := range []Authenticator{NewHeaderAuth("X-Api-Key", "header-token"), NewQueryAuth("key", "query-token")} {
+		var buf bytes.Buffer
+		logger := logging.New()
+		logger.SetOutput(&buf)
+		client := &Client{Config: &Config{Auth: auth, Debug: &DebugPolicy{Logger: logger}}}
+		if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/report?page=1", Auth: true}); err != nil {
+			t.Fatalf("GetNet() error = %v", err)
+		}
+		out := buf.String()
+		if strings.Contains(out, "header-token") || strings.Contains(out, "query-token") {
+			t.Errorf("dump contains token\n%s", out)
+		}
+		if !strings.Contains(out, `"X-Api-Key":["***"]`) && !strings.Contains(out, "key=***&page=1") {
+			t.Errorf("dump does not redact %T\n%s", auth, out)
+		}
+	}
+}
+
+func Test_DebugMaxBody(t *testing.T) {
+	p := &DebugPolicy{MaxBody: 4}
+	client := &Client{Config: &Config{}}
+	if got := client.redactBody([]byte(`abcdefgh`), "text/plain", p); got != "abcd...(truncated)" {
+		t.Errorf("redactBody() = %s", got)
+	}
+	p.MaxBody = -1
+	if got := client.redactBody([]byte(`abcdefgh`), "text/plain", p); got != "" {
+		t.Errorf("redactBody() = %s, want empty", got)
+	}
+}
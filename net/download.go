@@ -0,0 +1,243 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Progress 传输进度回调，total 未知时为 -1
+type Progress func(transferred, total int64)
+
+// DownloadTo 下载文件写入 w，返回内容不会读入内存
+// 下载不受 TimeOver/TimeOut 限制，使用 ctx 控制取消和超时
+func (n *Client) DownloadTo(ctx context.Context, sr *ServerResponse, w io.Writer, progress Progress) (int64, error) {
+	resp, err := n.openDownload(ctx, sr, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, downloadError(sr, resp)
+	}
+
+	written, err := copyProgress(w, resp.Body, 0, resp.ContentLength, progress)
+	if err != nil {
+		return written, fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, wrapTimeout(ctx, err))
+	}
+	return written, nil
+}
+
+// DownloadFile 下载文件到 path，先写入 path.download 临时文件，下载完成后重命名为 path
+// 临时文件已存在时使用 Range 请求从已下载的位置继续下载
+func (n *Client) DownloadFile(ctx context.Context, sr *ServerResponse, path string, progress Progress) error {
+	tmp := path + ".download"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.openDownload(ctx, sr, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 服务端不支持 Range 时重新下载
+		if offset > 0 {
+			offset = 0
+			if err = f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("[%s] %s 返回 Content-Range %q 与已下载大小 %d 不一致", http.MethodGet, sr.FullPath, resp.Header.Get("Content-Range"), offset)
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 返回的大小与临时文件一致时已经下载完整，否则删除临时文件重新下载
+		_, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if offset > 0 && ok && size == offset {
+			return finishDownload(f, tmp, path)
+		}
+		if offset == 0 {
+			return downloadError(sr, resp)
+		}
+		resp.Body.Close()
+		f.Close()
+		if err = os.Remove(tmp); err != nil {
+			return err
+		}
+		return n.DownloadFile(ctx, sr, path, progress)
+	default:
+		return downloadError(sr, resp)
+	}
+
+	_, err = copyProgress(f, resp.Body, offset, total, progress)
+	if err != nil {
+		return fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, wrapTimeout(ctx, err))
+	}
+	return finishDownload(f, tmp, path)
+}
+
+// maxEnvelopeBody 下载返回 json 时按 Envelope 检查的最大长度，超出时作为文件内容
+const maxEnvelopeBody = 1 << 20
+
+// openDownload 发送下载请求，offset 大于 0 时使用 Range 请求
+// 平台返回 json 响应时按 Envelope 检查，token 失效时重新登录后再请求一次，业务错误返回 APIError
+func (n *Client) openDownload(ctx context.Context, sr *ServerResponse, offset int64) (*http.Response, error) {
+	var stale string
+	if sr.Auth && n.TokenClient != nil {
+		stale = n.renewIfExpiring(ctx)
+	}
+	resp, res, err := n.openDownloadOnce(ctx, sr, offset)
+	if err != nil || res == nil {
+		return resp, err
+	}
+	if sr.Auth && (res.Outcome == OutcomeAuthExpired || res.Outcome == OutcomeRefreshToken) {
+		err = n.recoverToken(ctx, res.Outcome, stale)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %s 【%d】 %w", http.MethodGet, sr.FullPath, res.Code, err)
+		}
+		resp, res, err = n.openDownloadOnce(ctx, sr, offset)
+		if err != nil || res == nil {
+			return resp, err
+		}
+	}
+	return nil, &APIError{Method: http.MethodGet, Path: sr.FullPath, Status: res.Status, Code: res.Code, Message: res.Message}
+}
+
+// openDownloadOnce 返回内容是 Envelope 格式且不是成功结果时返回 res，此时响应已关闭
+func (n *Client) openDownloadOnce(ctx context.Context, sr *ServerResponse, offset int64) (*http.Response, *Result, error) {
+	req, err := n.newRequest(ctx, http.MethodGet, sr.FullPath, "application/x-www-form-urlencoded; param=value", nil, sr.Auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	call := &Call{Request: req}
+	err = n.invoke(call)
+	if err != nil {
+		if call.Response != nil {
+			call.Response.Body.Close()
+		}
+		return nil, nil, err
+	}
+
+	resp := call.Response
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") ||
+		(resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent) {
+		return resp, nil, nil
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, maxEnvelopeBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, wrapTimeout(ctx, err))
+	}
+	if len(head) <= maxEnvelopeBody {
+		res, err := n.envelope().Decode(resp.StatusCode, head)
+		if err == nil && res.Outcome != OutcomeSuccess {
+			res.Status = resp.StatusCode
+			resp.Body.Close()
+			return nil, res, nil
+		}
+	}
+	// 不是 Envelope 格式，已读取的内容放回响应
+	resp.Body = &struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return resp, nil, nil
+}
+
+func finishDownload(f *os.File, tmp, path string) error {
+	err := f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func downloadError(sr *ServerResponse, resp *http.Response) error {
+	return &APIError{Method: http.MethodGet, Path: sr.FullPath, Status: resp.StatusCode, Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+}
+
+// parseContentRange 解析 "bytes 100-199/200" 和 "bytes */200"，total 未知时为 -1
+func parseContentRange(s string) (start, total int64, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "bytes ")
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, 0, false
+	}
+	total = -1
+	if s[i+1:] != "*" {
+		var err error
+		total, err = strconv.ParseInt(s[i+1:], 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	if s[:i] == "*" {
+		return 0, total, true
+	}
+	j := strings.IndexByte(s[:i], '-')
+	if j < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(s[:j], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// copyProgress 复制数据并回调进度，offset 为已传输的大小
+func copyProgress(dst io.Writer, src io.Reader, offset, total int64, progress Progress) (int64, error) {
+	if progress == nil {
+		return io.Copy(dst, src)
+	}
+	pw := &progressWriter{w: dst, done: offset, total: total, progress: progress}
+	written, err := io.Copy(pw, src)
+	return written, err
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	pw.progress(pw.done, pw.total)
+	return n, err
+}
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Download(t *testing.T) {
+	content := strings.Repeat("firmware", 1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "firmware.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	client := &Client{Config: &Config{}}
+	sr := &ServerResponse{FullPath: ts.URL}
+
+	t.Run("DownloadTo", func(t *testing.T) {
+		var last int64
+		buf := &bytes.Buffer{}
+		n, err := client.DownloadTo(context.Background(), sr, buf, func(transferred, total int64) {
+			last = transferred
+		})
+		if err != nil || n != int64(len(content)) || buf.String() != content {
+			t.Errorf("DownloadTo() = %d, %v", n, err)
+		}
+		if last != int64(len(content)) {
+			t.Errorf("progress = %d, want %d", last, len(content))
+		}
+	})
+
+	t.Run("DownloadFile resume", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "firmware.bin")
+		err := os.WriteFile(path+".download", []byte(content[:100]), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var first, total int64 = -1, 0
+		err = client.DownloadFile(context.Background(), sr, path, func(transferred, size int64) {
+			if first < 0 {
+				first = transferred
+			}
+			total = size
+		})
+		if err != nil {
+			t.Fatalf("DownloadFile() error = %v", err)
+		}
+		b, _ := os.ReadFile(path)
+		if string(b) != content {
+			t.Errorf("DownloadFile() content length = %d, want %d", len(b), len(content))
+		}
+		if first <= 100 || total != int64(len(content)) {
+			t.Errorf("progress first = %d total = %d, want resume after 100 bytes", first, total)
+		}
+		if _, err := os.Stat(path + ".download"); !os.IsNotExist(err) {
+			t.Errorf("temp file still exists")
+		}
+	})
+
+	t.Run("DownloadFile 416 without total", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Write([]byte(content))
+		}))
+		defer ts.Close()
+
+		path := filepath.Join(t.TempDir(), "firmware.bin")
+		if err := os.WriteFile(path+".download", []byte(content[:100]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := client.DownloadFile(context.Background(), &ServerResponse{FullPath: ts.URL}, path, nil)
+		if err != nil {
+			t.Fatalf("DownloadFile() error = %v", err)
+		}
+		b, _ := os.ReadFile(path)
+		if string(b) != content {
+			t.Errorf("DownloadFile() content length = %d, want %d", len(b), len(content))
+		}
+	})
+
+	t.Run("envelope response", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"code":500,"message":"文件不存在"}`))
+		}))
+		defer ts.Close()
+
+		path := filepath.Join(t.TempDir(), "firmware.bin")
+		err := client.DownloadFile(context.Background(), &ServerResponse{FullPath: ts.URL}, path, nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 500 {
+			t.Errorf("DownloadFile() error = %v, want APIError", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("envelope response saved as file")
+		}
+		_, err = client.DownloadTo(context.Background(), &ServerResponse{FullPath: ts.URL}, &bytes.Buffer{}, nil)
+		if !errors.As(err, &apiErr) {
+			t.Errorf("DownloadTo() error = %v, want APIError", err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package net
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Outcome 返回内容的处理结果
+type Outcome int
+
+const (
+	OutcomeSuccess      Outcome = iota // 请求成功
+	OutcomeAuthExpired                 // token 失效，需要重新登录
+	OutcomeRefreshToken                // token 需要刷新
+	OutcomeError                       // 业务错误
+)
+
+// Result 解析后的返回内容
+type Result struct {
+	Outcome Outcome
+	Code    int
+	Message string
+	Data    json.RawMessage
+	Status  int // http 状态码，由 Client 在 Decode 之后填写
+}
+
+// Envelope 解析返回内容，status 为 http 状态码，body 可能为空，
+// 不接受空内容时返回 ErrEmptyResponse
+type Envelope interface {
+	Decode(status int, body []byte) (*Result, error)
+}
+
+// DefaultEnvelope {code,message,data} 格式，200 成功，401 重新登录，402 刷新 token
+var DefaultEnvelope Envelope = &CodeEnvelope{
+	CodeKey:         "code",
+	MessageKey:      "message",
+	DataKey:         "data",
+	SuccessCode:     200,
+	AuthExpiredCode: 401,
+	RefreshCode:     402,
+}
+
+// CodeEnvelope 返回内容中带业务 code 的格式，例如 {errcode,errmsg}
+type CodeEnvelope struct {
+	CodeKey         string
+	MessageKey      string
+	DataKey         string // 为空时整个返回内容作为 data
+	SuccessCode     int
+	AuthExpiredCode int // 0 表示不处理
+	RefreshCode     int // 0 表示不处理
+}
+
+func (e *CodeEnvelope) Decode(status int, body []byte) (*Result, error) {
+	if len(body) == 0 {
+		return nil, ErrEmptyResponse
+	}
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	if raw, ok := fields[e.CodeKey]; ok {
+		res.Code, err = decodeCode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.CodeKey, err)
+		}
+	}
+	if raw, ok := fields[e.MessageKey]; ok {
+		_ = json.Unmarshal(raw, &res.Message)
+	}
+	if e.DataKey == "" {
+		res.Data = body
+	} else {
+		res.Data = fields[e.DataKey]
+	}
+
+	switch {
+	case res.Code == e.SuccessCode:
+		res.Outcome = OutcomeSuccess
+	case e.AuthExpiredCode != 0 && res.Code == e.AuthExpiredCode:
+		res.Outcome = OutcomeAuthExpired
+	case e.RefreshCode != 0 && res.Code == e.RefreshCode:
+		res.Outcome = OutcomeRefreshToken
+	default:
+		res.Outcome = OutcomeError
+	}
+	return res, nil
+}
+
+// decodeCode code 兼容数字和数字字符串
+func decodeCode(raw json.RawMessage) (int, error) {
+	var code int
+	err := json.Unmarshal(raw, &code)
+	if err == nil {
+		return code, nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(s))
+}
+
+// StatusEnvelope 使用 http 状态码判断结果，返回内容整体作为 data，允许 204 等空内容和非 json 内容
+type StatusEnvelope struct {
+	RefreshStatus int // 需要刷新 token 的状态码，0 表示不处理
+}
+
+func (e *StatusEnvelope) Decode(status int, body []byte) (*Result, error) {
+	res := &Result{Code: status, Message: http.StatusText(status)}
+	if len(body) > 0 {
+		res.Data = body
+	}
+	switch {
+	case status >= 200 && status < 300:
+		res.Outcome = OutcomeSuccess
+	case status == http.StatusUnauthorized:
+		res.Outcome = OutcomeAuthExpired
+	case e.RefreshStatus != 0 && status == e.RefreshStatus:
+		res.Outcome = OutcomeRefreshToken
+	default:
+		res.Outcome = OutcomeError
+	}
+	return res, nil
+}
+
+func (n *Client) envelope() Envelope {
+	if n.Config.Envelope != nil {
+		return n.Config.Envelope
+	}
+	return DefaultEnvelope
+}
@@ -0,0 +1,72 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_EnvelopeDecode(t *testing.T) {
+	wechat := &CodeEnvelope{CodeKey: "errcode", MessageKey: "errmsg", SuccessCode: 0, AuthExpiredCode: 40014}
+	tests := []struct {
+		name     string
+		envelope Envelope
+		status   int
+		body     string
+		outcome  Outcome
+		code     int
+	}{
+		{name: "默认成功", envelope: DefaultEnvelope, status: 200, body: `{"code":200,"message":"ok","data":[1]}`, outcome: OutcomeSuccess, code: 200},
+		{name: "默认重新登录", envelope: DefaultEnvelope, status: 200, body: `{"code":401,"message":"login"}`, outcome: OutcomeAuthExpired, code: 401},
+		{name: "默认刷新", envelope: DefaultEnvelope, status: 200, body: `{"code":"402","message":"refresh"}`, outcome: OutcomeRefreshToken, code: 402},
+		{name: "默认业务错误", envelope: DefaultEnvelope, status: 200, body: `{"code":500,"message":"err"}`, outcome: OutcomeError, code: 500},
+		{name: "errcode 成功", envelope: wechat, status: 200, body: `{"errcode":0,"errmsg":"ok"}`, outcome: OutcomeSuccess},
+		{name: "errcode 失效", envelope: wechat, status: 200, body: `{"errcode":40014,"errmsg":"invalid"}`, outcome: OutcomeAuthExpired, code: 40014},
+		{name: "状态码成功", envelope: &StatusEnvelope{}, status: 201, body: `[]`, outcome: OutcomeSuccess, code: 201},
+		{name: "状态码失效", envelope: &StatusEnvelope{}, status: http.StatusUnauthorized, body: `{}`, outcome: OutcomeAuthExpired, code: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.envelope.Decode(tt.status, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if res.Outcome != tt.outcome || res.Code != tt.code {
+				t.Errorf("Decode() = %v %d, want %v %d", res.Outcome, res.Code, tt.outcome, tt.code)
+			}
+		})
+	}
+
+	if _, err := DefaultEnvelope.Decode(200, []byte("<html>")); err == nil {
+		t.Errorf("Decode() invalid json should return error")
+	}
+}
+
+func Test_StatusEnvelopeBody(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &Client{Config: &Config{Envelope: &StatusEnvelope{}}}
+	sr := &ServerResponse{FullPath: ts.URL + "/empty", ResponseInfo: &ResponseInfo{}}
+	if _, err := client.GetNet(sr); err != nil {
+		t.Errorf("GetNet() 204 error = %v", err)
+	}
+	if sr.ResponseInfo.Code != http.StatusNoContent || sr.ResponseInfo.RawData != nil {
+		t.Errorf("GetNet() 204 = %+v", sr.ResponseInfo)
+	}
+
+	sr = &ServerResponse{FullPath: ts.URL + "/text", ResponseInfo: &ResponseInfo{}}
+	if _, err := client.GetNet(sr); err != nil {
+		t.Errorf("GetNet() text error = %v", err)
+	}
+	if string(sr.ResponseInfo.RawData) != "pong" || sr.ResponseInfo.Data != nil {
+		t.Errorf("GetNet() text = %+v", sr.ResponseInfo)
+	}
+}
@@ -0,0 +1,73 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyResponse 服务端没有返回数据
+	ErrEmptyResponse = errors.New("没有返回数据")
+	// ErrTimeout 请求超过 TimeOut/TimeOver 或 ctx 截止时间
+	ErrTimeout = errors.New("请求超时")
+)
+
+// DecodeError 返回内容不能解析，Body 为原始返回内容
+type DecodeError struct {
+	Method string
+	Path   string
+	Status int // http 状态码
+	Body   []byte
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("[%s] %s json.Unmarshal error：%v ,with result: %s", e.Method, e.Path, e.Err, string(e.Body))
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// APIError 服务端返回的业务错误
+type APIError struct {
+	Method  string
+	Path    string
+	Status  int // http 状态码，0 表示未知
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("[%s] %s 返回错误信息 %s 【%d】", e.Method, e.Path, e.Message, e.Code)
+}
+
+// timeoutError 包装超时错误，同时满足 errors.Is(err, ErrTimeout) 和原始错误判断
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrTimeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// wrapTimeout 超时错误转为 ErrTimeout
+func wrapTimeout(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &timeoutError{err: err}
+	}
+	var te interface{ Timeout() bool }
+	if errors.As(err, &te) && te.Timeout() {
+		return &timeoutError{err: err}
+	}
+	return err
+}
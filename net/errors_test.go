@@ -0,0 +1,58 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Errors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	})
+	mux.HandleFunc("/business", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":4001,"message":"参数错误"}`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &Client{Config: &Config{TimeOver: 1, TimeOut: 5}}
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/empty", ResponseInfo: &ResponseInfo{}})
+		if !errors.Is(err, ErrEmptyResponse) {
+			t.Errorf("error = %v, want ErrEmptyResponse", err)
+		}
+	})
+	t.Run("decode", func(t *testing.T) {
+		_, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/html", ResponseInfo: &ResponseInfo{}})
+		var de *DecodeError
+		if !errors.As(err, &de) || string(de.Body) != "<html></html>" {
+			t.Errorf("error = %v, want *DecodeError with body", err)
+		}
+	})
+	t.Run("business", func(t *testing.T) {
+		_, err := client.POSTNet(&ServerResponse{FullPath: ts.URL + "/business", ResponseInfo: &ResponseInfo{}}, "")
+		var ae *APIError
+		if !errors.As(err, &ae) || ae.Code != 4001 || ae.Method != http.MethodPost {
+			t.Errorf("error = %v, want *APIError code 4001", err)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		_, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/slow", ResponseInfo: &ResponseInfo{}})
+		if !errors.Is(err, ErrTimeout) {
+			t.Errorf("error = %v, want ErrTimeout", err)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type flightCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// flightGroup 每个 Client 同时只有一个登录或刷新请求，其他调用等待并共享结果，
+// token 由执行请求的调用保存到 Client 自己的 TokenClient
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do 相同 key 的调用只执行一次 fn，等待中的调用返回同一个结果，
+// 等待中的 ctx 结束时直接返回，执行的调用因为自己的 ctx 结束失败时等待中的调用重新执行
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() (string, error)) (string, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = map[string]*flightCall{}
+		}
+		c, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-c.done:
+		}
+		if (errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded)) && ctx.Err() == nil {
+			continue
+		}
+		return c.token, c.err
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.token, c.err = fn()
+	return c.token, c.err
+}
@@ -2,14 +2,14 @@ package net
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"net/url"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/chindeo/pkg/net/token"
@@ -23,65 +23,120 @@ type Client struct {
 	Transport   http.RoundTripper
 	Config      *Config
 	TokenClient token.TokenClient
+
+	breakers sync.Map // host -> *breaker
+	limiters sync.Map // host -> *limiter, "" for the whole client
+
+	httpClient  *http.Client // Jar is a *CookieJar when Config.CookieJar is set
+	cacheOnce   sync.Once
+	memoryCache *MemoryCache
+	queue       *diskQueue  // POSTNet store and forward queue, nil when Config.Queue is not set
+	tokenFlight flightGroup // one login or refresh at a time, token saved to this client's TokenClient
 }
 
 type Config struct {
-	Appid       string
-	AppSecret   string
-	Proxy       string
-	LoginData   string
-	LoginUrl    string
-	RefreshUrl  string
-	TimeOver    int64
-	TimeOut     int64
-	TokenDriver string
-	Host        string            // driver redis host
-	Pwd         string            // driver redis password
-	Headers     map[string]string // request headers
+	Appid        string
+	AppSecret    string
+	Proxy        string
+	LoginData    string
+	LoginUrl     string
+	RefreshUrl   string
+	TimeOver     int64 // whole request deadline in seconds, includes reading body
+	TimeOut      int64 // same as TimeOver, the smaller one is used
+	TokenDriver  string
+	Host         string            // driver redis host
+	Pwd          string            // driver redis password
+	Headers      map[string]string // request headers
+	Retry        *RetryPolicy      // retry policy, nil means no retry
+	Envelope     Envelope          // response envelope codec, nil means DefaultEnvelope
+	Interceptors []Interceptor     // request interceptors, the first one is the outermost
+	Sign         bool              // sign every request with Appid/AppSecret HMAC-SHA256, see Verify
+	Breaker      *BreakerPolicy    // per host circuit breaker, nil means disabled
+	Limit        *LimitPolicy      // client side rate limit and max in-flight requests, nil means disabled
+	Transport    *TransportOptions // connection pool and TLS options
+	ProxyRules   []ProxyRule       // per request proxy rules, Proxy is used as the last rule
+	Cache        *CachePolicy      // GetNet response cache, nil means disabled
+	CookieJar    bool              // keep every response cookie in a CookieJar persisted by the token driver
+	Debug        *DebugPolicy      // log every request and response with secrets redacted, nil means disabled
+	Metrics      *Metrics          // per endpoint request metrics, may be shared by several clients, nil means disabled
+	Trace        *TracePolicy      // start a client span per request and propagate it, nil means disabled
+	Queue        *QueuePolicy      // store and forward POSTNet reports while the platform is unreachable, nil means disabled
+
+	Auth               Authenticator // how authenticated requests carry credentials, nil means XTokenAuth
+	TokenTTL           time.Duration // token lifetime when login does not return ExpiresIn/ExpiresAt
+	TokenRefreshMargin time.Duration // refresh token this long before it expires, default one minute
 }
 
+// NewNetClient 初始化全局 NetClient，已经初始化过时直接返回
+// Deprecated: 使用 New 创建独立的 Client
 func NewNetClient(config *Config) error {
-
 	if NetClient != nil {
 		return nil
 	}
 
-	NetClient = &Client{Config: config}
+	client, err := New(config)
+	if err != nil {
+		return err
+	}
+	NetClient = client
+	return nil
+}
+
+// New 创建独立的 Client，每个 Client 有自己的 Transport，token 存储和请求头
+func New(config *Config) (*Client, error) {
+	if config.TokenDriver == "redis" && (config.Host == "") {
+		return nil, errors.New("redis driver need set redis host")
+	}
 
-	// 添加代理
-	if config.Proxy != "" {
-		proxy := func(_ *http.Request) (*url.URL, error) {
-			return url.Parse(config.Proxy)
+	cfg := *config
+	if config.Headers != nil {
+		cfg.Headers = make(map[string]string, len(config.Headers))
+		for key, value := range config.Headers {
+			cfg.Headers[key] = value
 		}
-		NetClient.Transport = &http.Transport{Proxy: proxy}
 	}
+	client := &Client{Config: &cfg}
+
+	transport, err := newTransport(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = transport
+	client.httpClient = &http.Client{Transport: transport}
 
-	switch config.TokenDriver {
+	switch cfg.TokenDriver {
 	case "local":
-		NetClient.TokenClient = &token.LocalClient{AppID: config.Appid}
+		client.TokenClient = &token.LocalClient{AppID: cfg.Appid}
 	case "redis":
-		NetClient.TokenClient = &token.RedisClient{AppID: config.Appid, Host: config.Host, Pwd: config.Pwd}
+		client.TokenClient = &token.RedisClient{AppID: cfg.Appid, Host: cfg.Host, Pwd: cfg.Pwd}
 	default:
-		NetClient.TokenClient = &token.LocalClient{AppID: config.Appid}
+		client.TokenClient = &token.LocalClient{AppID: cfg.Appid}
 	}
 
-	NetClient.TokenClient.GetCache()
+	client.TokenClient.GetCache()
 
-	if config.TokenDriver == "redis" && (config.Host == "") {
-		return errors.New("redis driver need set redis host")
-	}
-	err := NetClient.TokenClient.Ping()
+	err = client.TokenClient.Ping()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
+	if cfg.CookieJar {
+		client.httpClient.Jar = NewCookieJar(client.TokenClient)
+	}
 
-type responseToken struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    *Token `json:"data"`
+	if cfg.Queue != nil {
+		client.queue, err = openQueue(cfg.Queue)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Metrics != nil {
+			cfg.Metrics.registerQueue(cfg.Queue.Dir, client.queue)
+		}
+		client.queue.wg.Add(1)
+		go client.replayLoop()
+	}
+
+	return client, nil
 }
 
 type Req struct {
@@ -91,23 +146,54 @@ type Req struct {
 }
 
 type Token struct {
-	XToken string `json:"AccessToken"`
+	XToken    string `json:"AccessToken"`
+	ExpiresIn int64  `json:"ExpiresIn"` // 有效期，秒
+	ExpiresAt int64  `json:"ExpiresAt"` // 过期时间，unix 秒
+}
+
+// expireAt 登录接口没有返回过期时间时使用 ttl，ttl 为 0 表示过期时间未知
+func (t *Token) expireAt(now time.Time, ttl time.Duration) time.Time {
+	switch {
+	case t.ExpiresAt > 0:
+		return time.Unix(t.ExpiresAt, 0)
+	case t.ExpiresIn > 0:
+		return now.Add(time.Duration(t.ExpiresIn) * time.Second)
+	case ttl > 0:
+		return now.Add(ttl)
+	}
+	return time.Time{}
 }
 
 type ServerResponse struct {
 	FullPath     string
 	Auth         bool
+	Retry        bool        // POST 等非幂等请求是否按 Config.Retry 重试
+	Data         interface{} // 不为空时请求成功后 data 直接解析到 Data，不再解析到 ResponseInfo.Data
 	ResponseInfo *ResponseInfo
 }
 
 type ResponseInfo struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    interface{}     `json:"data"`
+	RawData json.RawMessage `json:"-"` // 原始 data 内容
+}
+
+// DecodeData 将原始 data 内容解析到 v
+func (ri *ResponseInfo) DecodeData(v interface{}) error {
+	if len(ri.RawData) == 0 {
+		return ErrEmptyResponse
+	}
+	return json.Unmarshal(ri.RawData, v)
 }
 
-//POSTNet  提交数据
+// Upload  上传文件
 func (n *Client) Upload(sr *ServerResponse, name, filename string, params map[string]string, src io.Reader) ([]byte, error) {
+	return n.UploadContext(context.Background(), sr, name, filename, params, src)
+}
+
+// UploadContext  上传文件，ctx 取消或超时会中断请求
+func (n *Client) UploadContext(ctx context.Context, sr *ServerResponse, name, filename string, params map[string]string, src io.Reader) ([]byte, error) {
 	body := &bytes.Buffer{}                            // 初始化body参数
 	writer := multipart.NewWriter(body)                // 实例化multipart
 	part, err := writer.CreateFormFile(name, filename) // 创建multipart 文件字段
@@ -126,201 +212,433 @@ func (n *Client) Upload(sr *ServerResponse, name, filename string, params map[st
 		return nil, err
 	}
 	formcontenttype := writer.FormDataContentType()
-	result := n.request(http.MethodPost, sr.FullPath, formcontenttype, body, sr.Auth)
-	if len(result) == 0 {
-		return result, fmt.Errorf("post %s 没有返回数据", sr.FullPath)
-	}
-	err = json.Unmarshal(result, sr.ResponseInfo)
-	if err != nil {
-		return result, fmt.Errorf("dopost: %s json.Unmarshal error：%w ,with result: %v", sr.FullPath, err, string(result))
+	return n.send(ctx, http.MethodPost, sr, bytesBody(formcontenttype, body.Bytes()))
+}
+
+// POSTNet  提交数据
+func (n *Client) POSTNet(sr *ServerResponse, data string) ([]byte, error) {
+	return n.POSTNetContext(context.Background(), sr, data)
+}
+
+// POSTNetContext  提交数据，ctx 取消或超时会中断请求
+func (n *Client) POSTNetContext(ctx context.Context, sr *ServerResponse, data string) ([]byte, error) {
+	if n.queue != nil {
+		return n.postQueued(ctx, sr, data)
 	}
+	return n.send(ctx, http.MethodPost, sr, formBody(data))
+}
 
-	if sr.ResponseInfo.Code == 401 {
-		n.TokenClient.SetCacheToken("")
-		token, err := n.GetToken()
-		if err != nil {
-			return result, fmt.Errorf("post %s get token err %w", sr.FullPath, err)
-		}
-		return result, fmt.Errorf("post %s get token %s", sr.FullPath, token)
-	} else if sr.ResponseInfo.Code == 402 {
-		n.TokenClient.SetCacheToken("")
-		token, err := n.RfreshToken()
+// PostJSON  以 json 格式提交数据
+func (n *Client) PostJSON(sr *ServerResponse, payload interface{}) ([]byte, error) {
+	return n.SendJSONContext(context.Background(), http.MethodPost, sr, payload)
+}
+
+// PutJSON  以 json 格式提交数据
+func (n *Client) PutJSON(sr *ServerResponse, payload interface{}) ([]byte, error) {
+	return n.SendJSONContext(context.Background(), http.MethodPut, sr, payload)
+}
+
+// PatchJSON  以 json 格式提交数据
+func (n *Client) PatchJSON(sr *ServerResponse, payload interface{}) ([]byte, error) {
+	return n.SendJSONContext(context.Background(), http.MethodPatch, sr, payload)
+}
+
+// DeleteJSON  删除数据，payload 为 nil 时不发送请求内容
+func (n *Client) DeleteJSON(sr *ServerResponse, payload interface{}) ([]byte, error) {
+	return n.SendJSONContext(context.Background(), http.MethodDelete, sr, payload)
+}
+
+// SendJSONContext  以 json 格式发送请求，payload 为 nil 时不发送请求内容
+func (n *Client) SendJSONContext(ctx context.Context, method string, sr *ServerResponse, payload interface{}) ([]byte, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
 		if err != nil {
-			return result, fmt.Errorf("post %s %w", sr.FullPath, err)
+			return nil, fmt.Errorf("[%s] %s json.Marshal error：%w", method, sr.FullPath, err)
 		}
-		return result, fmt.Errorf("post %s token %s", sr.FullPath, token)
-	} else if sr.ResponseInfo.Code != 200 {
-		return result, fmt.Errorf("post [%s] 返回错误信息 [%s] 【%d】", sr.FullPath, sr.ResponseInfo.Message, sr.ResponseInfo.Code)
 	}
-	return result, nil
+	return n.send(ctx, method, sr, bytesBody("application/json; charset=utf-8", body))
 }
 
-//POSTNet  提交数据
-func (n *Client) POSTNet(sr *ServerResponse, data string) ([]byte, error) {
-	result := n.request(http.MethodPost, sr.FullPath, "application/x-www-form-urlencoded; param=value", strings.NewReader(data), sr.Auth)
-	if len(result) == 0 {
-		return result, fmt.Errorf("[%s] %s?%s 没有返回数据", http.MethodPost, sr.FullPath, data)
-	}
-	err := json.Unmarshal(result, sr.ResponseInfo)
-	if err != nil {
-		return result, fmt.Errorf("[%s] %s json.Unmarshal error：%w ,with result: %v", http.MethodPost, sr.FullPath, err, string(result))
-	}
+// GetFile  下载文件
+func (n *Client) GetFile(sr *ServerResponse) ([]byte, error) {
+	return n.GetFileContext(context.Background(), sr)
+}
 
-	if sr.ResponseInfo.Code == 401 {
-		n.TokenClient.SetCacheToken("")
-		token, err := n.GetToken()
+// GetFileContext  下载文件，ctx 取消或超时会中断请求
+func (n *Client) GetFileContext(ctx context.Context, sr *ServerResponse) ([]byte, error) {
+	var result []byte
+	err := n.withRetry(ctx, http.MethodGet, sr, func() (int, int, error) {
+		call, err := n.request(ctx, http.MethodGet, sr.FullPath, formBody(""), sr.Auth, false)
+		status := call.StatusCode()
+		result = call.Body
 		if err != nil {
-			return result, fmt.Errorf("[%s] %s %w", sr.FullPath, sr.FullPath, err)
+			return status, 0, err
 		}
-		return result, fmt.Errorf("[%s]  %s  %s", sr.FullPath, sr.FullPath, token)
-	} else if sr.ResponseInfo.Code == 402 {
-		n.TokenClient.SetCacheToken("")
-		token, err := n.RfreshToken()
-		if err != nil {
-			return result, fmt.Errorf("post %s refresh token err %w", sr.FullPath, err)
+		if status >= http.StatusInternalServerError {
+			return status, 0, fmt.Errorf("[%s] %s 返回状态 %d", http.MethodGet, sr.FullPath, status)
 		}
-		return result, fmt.Errorf("post %s refresh token %s", sr.FullPath, token)
-	} else if sr.ResponseInfo.Code != 200 {
-		return result, fmt.Errorf("post %s 返回错误信息 %s 【%d】", sr.FullPath, sr.ResponseInfo.Message, sr.ResponseInfo.Code)
+		return status, 0, nil
+	})
+	if err != nil {
+		return result, err
 	}
-	return result, nil
-}
-
-//GetFile  下载文件
-func (n *Client) GetFile(sr *ServerResponse) ([]byte, error) {
-	result := n.request(http.MethodGet, sr.FullPath, "application/x-www-form-urlencoded; param=value", nil, sr.Auth)
 	if len(result) == 0 {
-		return result, fmt.Errorf("[%s] %s 没有返回数据", http.MethodGet, sr.FullPath)
+		return result, fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, ErrEmptyResponse)
 	}
 	return result, nil
 }
 
-//GetNet  获取数据
+// GetNet  获取数据
 func (n *Client) GetNet(sr *ServerResponse) ([]byte, error) {
-	result := n.request(http.MethodGet, sr.FullPath, "application/x-www-form-urlencoded; param=value", nil, sr.Auth)
-	if len(result) == 0 {
-		return result, fmt.Errorf("[%s] %s 没有返回数据", http.MethodGet, sr.FullPath)
+	return n.GetNetContext(context.Background(), sr)
+}
+
+// GetNetContext  获取数据，ctx 取消或超时会中断请求
+func (n *Client) GetNetContext(ctx context.Context, sr *ServerResponse) ([]byte, error) {
+	body := formBody("")
+	body.cache = true
+	return n.send(ctx, http.MethodGet, sr, body)
+}
+
+// send 发送请求并按 Envelope 解析返回内容，token 失效时重新获取 token 并重放一次原请求
+func (n *Client) send(ctx context.Context, method string, sr *ServerResponse, body *requestBody) ([]byte, error) {
+	var stale string
+	if sr.Auth && n.TokenClient != nil {
+		stale = n.renewIfExpiring(ctx)
 	}
-	err := json.Unmarshal(result, sr.ResponseInfo)
+	result, res, err := n.sendRetry(ctx, method, sr, body)
 	if err != nil {
-		return result, fmt.Errorf("[%s] %s 获取服务解析返回内容报错 %w", http.MethodGet, sr.FullPath, err)
+		return result, err
 	}
 
-	if sr.ResponseInfo.Code == 401 {
-		n.TokenClient.SetCacheToken("")
-		_, err := n.GetToken()
-		if err != nil {
-			return result, fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, err)
+	if res.Outcome != OutcomeAuthExpired && res.Outcome != OutcomeRefreshToken {
+		return result, checkResult(method, sr, res)
+	}
+
+	err = n.recoverToken(ctx, res.Outcome, stale)
+	if err != nil {
+		return result, fmt.Errorf("[%s] %s 【%d】 %w", method, sr.FullPath, res.Code, err)
+	}
+	if !sr.Auth {
+		return result, checkResult(method, sr, res)
+	}
+
+	result, res, err = n.sendRetry(ctx, method, sr, body)
+	if err != nil {
+		return result, err
+	}
+	return result, checkResult(method, sr, res)
+}
+
+// sendRetry 按 Config.Retry 重试 sendOnce
+func (n *Client) sendRetry(ctx context.Context, method string, sr *ServerResponse, body *requestBody) ([]byte, *Result, error) {
+	var result []byte
+	var res *Result
+	err := n.withRetry(ctx, method, sr, func() (int, int, error) {
+		status, b, r, err := n.sendOnce(ctx, method, sr, body)
+		result, res = b, r
+		if r == nil {
+			return status, 0, err
 		}
-		return result, fmt.Errorf("[%s] %s %s", http.MethodGet, sr.FullPath, sr.ResponseInfo.Message)
-	} else if sr.ResponseInfo.Code == 402 {
-		n.TokenClient.SetCacheToken("")
-		token, err := n.RfreshToken()
+		return status, r.Code, err
+	})
+	return result, res, err
+}
+
+func (n *Client) sendOnce(ctx context.Context, method string, sr *ServerResponse, body *requestBody) (int, []byte, *Result, error) {
+	if sr.ResponseInfo == nil {
+		sr.ResponseInfo = &ResponseInfo{}
+	}
+	*sr.ResponseInfo = ResponseInfo{}
+	call, err := n.request(ctx, method, sr.FullPath, body, sr.Auth, true)
+	status, result, res := call.StatusCode(), call.Body, call.Result
+	if err != nil {
+		return status, result, nil, err
+	}
+	sr.ResponseInfo.Code = res.Code
+	sr.ResponseInfo.Message = res.Message
+	sr.ResponseInfo.RawData = res.Data
+	// 非 json 的 data 只保留在 RawData 中
+	var target interface{}
+	if sr.Data != nil && res.Outcome == OutcomeSuccess {
+		target = sr.Data
+	} else if json.Valid(res.Data) {
+		target = &sr.ResponseInfo.Data
+	}
+	if len(res.Data) > 0 && target != nil {
+		err = json.Unmarshal(res.Data, target)
 		if err != nil {
-			return result, fmt.Errorf("[%s] %s %w", http.MethodGet, sr.FullPath, err)
+			return status, result, nil, &DecodeError{Method: method, Path: sr.FullPath, Status: status, Body: result, Err: err}
 		}
-		return result, fmt.Errorf("[%s] %s  %s ", http.MethodGet, sr.FullPath, token)
-	} else if sr.ResponseInfo.Code != 200 {
-		return result, fmt.Errorf("[%s] %s  %s 【%d】", http.MethodGet, sr.FullPath, sr.ResponseInfo.Message, sr.ResponseInfo.Code)
 	}
-	return result, nil
+	return status, result, res, nil
+}
+
+// recoverToken token 失效通过 Authenticator 重新登录，需要刷新时先刷新，刷新失败时重新登录
+// stale 为请求时使用的 token，其他调用已经更新 token 时直接重放
+func (n *Client) recoverToken(ctx context.Context, outcome Outcome, stale string) error {
+	if n.TokenClient != nil {
+		if current := n.TokenClient.GetCacheToken(); current != "" && current != stale {
+			return nil
+		}
+	}
+	a := n.authenticator()
+	if outcome == OutcomeRefreshToken {
+		err := a.Refresh(ctx, n)
+		if err == nil {
+			return nil
+		}
+	}
+	if n.TokenClient != nil {
+		n.clearToken(stale)
+	}
+	return a.Login(ctx, n)
+}
+
+// clearToken 缓存的 token 仍然是 stale 时清除
+func (n *Client) clearToken(stale string) {
+	if n.TokenClient.GetCacheToken() == stale {
+		n.TokenClient.SetCacheToken("")
+	}
+}
+
+func checkResult(method string, sr *ServerResponse, res *Result) error {
+	if res.Outcome != OutcomeSuccess {
+		return &APIError{Method: method, Path: sr.FullPath, Status: res.Status, Code: res.Code, Message: res.Message}
+	}
+	return nil
 }
 
 // GetToken
 // data := fmt.Sprintf("appid=%s&appsecret=%s&apptype=%s", appid, appsecret, "hospital")
 func (n *Client) GetToken() (string, error) {
+	return n.GetTokenContext(context.Background())
+}
+
+// GetTokenContext 登录获取 token，ctx 取消或超时会中断请求
+// token 即将过期时提前刷新，同一个 appid 同时只有一个登录请求
+func (n *Client) GetTokenContext(ctx context.Context) (string, error) {
 	token := n.TokenClient.GetCacheToken()
 	if token != "" {
-		return token, nil
+		if !n.tokenExpiring(time.Now()) {
+			return token, nil
+		}
+		return n.renewToken(ctx, token)
 	}
+	return n.login(ctx)
+}
 
-	re := &responseToken{}
-	result := n.request(http.MethodPost, n.Config.LoginUrl, "application/x-www-form-urlencoded; param=value", strings.NewReader(n.Config.LoginData), false)
-	if len(result) == 0 {
-		return "", fmt.Errorf("GetToken  %s get empty data", n.Config.LoginUrl)
-	}
+// login 登录，等待中的调用共享同一个登录请求的结果
+func (n *Client) login(ctx context.Context) (string, error) {
+	return n.tokenFlight.Do(ctx, "login", func() (string, error) {
+		xToken, err := n.loginOnce(ctx)
+		n.observeToken(n.Config.LoginUrl, "login", err)
+		return xToken, err
+	})
+}
 
-	err := json.Unmarshal(result, re)
+func (n *Client) loginOnce(ctx context.Context) (string, error) {
+	call, err := n.request(ctx, http.MethodPost, n.Config.LoginUrl, formBody(n.Config.LoginData), false, true)
 	if err != nil {
-		return "", fmt.Errorf("unmarshal json %s error %w", string(result), err)
-	}
-
-	if re.Code == 200 {
-		n.TokenClient.SetCacheToken(re.Data.XToken)
-		return re.Data.XToken, nil
-	} else {
-		return "", fmt.Errorf(re.Message)
+		return "", err
 	}
+	return n.saveToken(call)
 }
 
 // RfreshToken
 func (n *Client) RfreshToken() (string, error) {
-	re := &responseToken{}
-	result := n.request(http.MethodGet, n.Config.RefreshUrl, "application/x-www-form-urlencoded; param=value", nil, true)
-	if len(result) == 0 {
-		return "", fmt.Errorf("RfreshToken  %s get empty data", n.Config.RefreshUrl)
-	}
-	err := json.Unmarshal(result, &re)
+	return n.RfreshTokenContext(context.Background())
+}
+
+// RfreshTokenContext 刷新 token，ctx 取消或超时会中断请求，同一个 appid 同时只有一个刷新请求
+func (n *Client) RfreshTokenContext(ctx context.Context) (string, error) {
+	return n.tokenFlight.Do(ctx, "refresh", func() (string, error) {
+		xToken, err := n.refreshOnce(ctx)
+		n.observeToken(n.Config.RefreshUrl, "refresh", err)
+		return xToken, err
+	})
+}
+
+func (n *Client) refreshOnce(ctx context.Context) (string, error) {
+	call, err := n.request(ctx, http.MethodGet, n.Config.RefreshUrl, formBody(""), true, true)
 	if err != nil {
-		return "", fmt.Errorf("unmarshal json %s error %w", string(result), err)
+		return "", err
 	}
-	if re.Code == 200 {
-		n.TokenClient.SetCacheToken(re.Data.XToken)
-		return re.Data.XToken, nil
-	} else {
-		return "", errors.New(re.Message)
+	return n.saveToken(call)
+}
+
+// renewIfExpiring 发送需要认证的请求前，token 即将过期时提前刷新，返回请求使用的 token
+func (n *Client) renewIfExpiring(ctx context.Context) string {
+	token := n.TokenClient.GetCacheToken()
+	if token == "" || !n.tokenExpiring(time.Now()) {
+		return token
 	}
+	renewed, err := n.renewToken(ctx, token)
+	if err != nil {
+		return token
+	}
+	return renewed
 }
 
-func (n *Client) request(method, url, contentType string, body io.Reader, auth bool) []byte {
-	result := make(chan []byte, 30)
-	T := time.NewTicker(time.Duration(n.Config.TimeOver) * time.Second)
-	go func() {
-		t := time.Duration(n.Config.TimeOut) * time.Second
-		Client := http.Client{Timeout: t, Transport: n.Transport}
-		req, err := http.NewRequest(method, url, body)
-		if err != nil {
-			result <- nil
-			return
-		}
-		req.Header.Set("Content-Type", contentType)
-		if len(n.Config.Headers) > 0 {
-			for key, value := range n.Config.Headers {
-				req.Header.Set(key, value)
+// renewToken 未过期时刷新 token，刷新失败继续使用原 token，已过期时重新登录
+func (n *Client) renewToken(ctx context.Context, token string) (string, error) {
+	if time.Now().Before(n.tokenExpire()) {
+		if n.Config.RefreshUrl != "" {
+			renewed, err := n.RfreshTokenContext(ctx)
+			if err == nil {
+				return renewed, nil
 			}
 		}
-		if auth && n.Config.Appid != "" {
-			req.Header.Set("X-Token", n.TokenClient.GetCacheToken())
-			phpSessionId := n.TokenClient.GetSessionId()
-			if phpSessionId != nil {
-				req.AddCookie(phpSessionId)
-			}
+		return token, nil
+	}
+	n.clearToken(token)
+	return n.login(ctx)
+}
+
+// tokenExpiring token 过期时间减去 TokenRefreshMargin 之后返回 true，没有过期时间时返回 false
+func (n *Client) tokenExpiring(now time.Time) bool {
+	expireAt := n.tokenExpire()
+	if expireAt.IsZero() {
+		return false
+	}
+	margin := n.Config.TokenRefreshMargin
+	if margin <= 0 {
+		margin = time.Minute
+	}
+	return !now.Before(expireAt.Add(-margin))
+}
+
+// saveToken 解析登录和刷新接口返回的 token 并缓存
+func (n *Client) saveToken(call *Call) (string, error) {
+	method, path, result, res := call.Request.Method, call.Request.URL.String(), call.Body, call.Result
+	if res.Outcome != OutcomeSuccess {
+		return "", &APIError{Method: method, Path: path, Status: res.Status, Code: res.Code, Message: res.Message}
+	}
+
+	re := &Token{}
+	err := json.Unmarshal(res.Data, re)
+	if err != nil {
+		return "", &DecodeError{Method: method, Path: path, Status: call.StatusCode(), Body: result, Err: err}
+	}
+	if re.XToken == "" {
+		return "", &DecodeError{Method: method, Path: path, Status: call.StatusCode(), Body: result, Err: errors.New("AccessToken is empty")}
+	}
+	n.TokenClient.SetCacheToken(re.XToken)
+	if expirer, ok := n.TokenClient.(token.TokenExpirer); ok {
+		expirer.SetCacheTokenExpire(re.expireAt(time.Now(), n.Config.TokenTTL))
+	}
+	return re.XToken, nil
+}
+
+// tokenExpire TokenClient 保存的 token 过期时间，没有实现 token.TokenExpirer 时为零值，不会提前刷新
+func (n *Client) tokenExpire() time.Time {
+	if expirer, ok := n.TokenClient.(token.TokenExpirer); ok {
+		return expirer.GetCacheTokenExpire()
+	}
+	return time.Time{}
+}
+
+// requestBody 请求内容，每次请求调用 open 创建新的 io.Reader，支持重试和重放
+type requestBody struct {
+	contentType string
+	open        func() (io.Reader, error)
+	stream      bool // 流式请求内容，不受 TimeOver/TimeOut 限制，由 ctx 控制
+	cache       bool // GetNet 请求，按 Config.Cache 缓存返回内容
+}
+
+// formBody 表单请求内容，data 为空时不发送请求内容
+func formBody(data string) *requestBody {
+	if data == "" {
+		return &requestBody{contentType: "application/x-www-form-urlencoded; param=value"}
+	}
+	return bytesBody("application/x-www-form-urlencoded; param=value", []byte(data))
+}
+
+func bytesBody(contentType string, data []byte) *requestBody {
+	body := &requestBody{contentType: contentType}
+	if data != nil {
+		body.open = func() (io.Reader, error) {
+			return bytes.NewReader(data), nil
 		}
-		var resp *http.Response
-		resp, err = Client.Do(req)
+	}
+	return body
+}
+
+// request 发送请求，decode 为 true 时按 Envelope 解析返回内容
+// 返回的 Call 不为 nil，Call.Response 为 nil 表示请求未得到响应
+func (n *Client) request(ctx context.Context, method, url string, body *requestBody, auth, decode bool) (*Call, error) {
+	call := &Call{readBody: true, decode: decode, cache: body.cache}
+	if timeout := n.timeout(); timeout > 0 && !body.stream {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body.open != nil {
+		var err error
+		reader, err = body.open()
 		if err != nil {
-			fmt.Println(err)
-			result <- nil
-			return
+			return call, fmt.Errorf("[%s] %s %w", method, url, err)
 		}
-		defer resp.Body.Close()
-
-		if !auth && n.Config.Appid != "" {
-			n.TokenClient.SetSessionId(resp.Cookies())
+	}
+	req, err := n.newRequest(ctx, method, url, body.contentType, reader, auth)
+	if err != nil {
+		if c, ok := reader.(io.Closer); ok {
+			c.Close()
 		}
+		return call, err
+	}
+	call.Request = req
 
-		buf := bytes.NewBuffer(nil)
-		io.Copy(buf, resp.Body)
-		result <- buf.Bytes()
+	err = n.invoke(call)
+	// 拦截器没有发送请求时由这里关闭请求内容，结束 UploadParts 写入的 goroutine
+	if call.Response == nil {
+		if c, ok := reader.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	if call.Response != nil && !auth && n.Config.Appid != "" {
+		n.TokenClient.SetSessionId(call.Response.Cookies())
+	}
+	// 拦截器没有发送请求也没有设置返回结果
+	if err == nil && decode && call.Result == nil {
+		err = fmt.Errorf("[%s] %s %w", method, url, ErrEmptyResponse)
+	}
+	return call, err
+}
 
-	}()
+// timeout TimeOver 和 TimeOut 中较小的一个，包含读取返回内容的时间
+func (n *Client) timeout() time.Duration {
+	timeout := time.Duration(n.Config.TimeOver) * time.Second
+	if t := time.Duration(n.Config.TimeOut) * time.Second; t > 0 && (timeout <= 0 || t < timeout) {
+		timeout = t
+	}
+	return timeout
+}
 
-	for {
-		select {
-		case x := <-result:
-			return x
-		case <-T.C:
-			return []byte("请求超时")
+// newRequest 创建请求，添加请求头和认证信息
+func (n *Client) newRequest(ctx context.Context, method, url, contentType string, body io.Reader, auth bool) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(n.Config.Headers) > 0 {
+		for key, value := range n.Config.Headers {
+			req.Header.Set(key, value)
+		}
+	}
+	if key := idempotencyKeyFrom(ctx); key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if auth {
+		err = n.authenticator().Apply(n, req)
+		if err != nil {
+			return nil, err
 		}
 	}
+	return req, nil
 }
@@ -1,48 +1,62 @@
 package net
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/nettest"
+	"github.com/chindeo/pkg/net/token"
 )
 
 var (
-	Host       string = "http://op.t.chindeo.com"
-	Appid      string = "XvtbOYC0VQEweLqW01cyHvn8TTDq9Yun"
-	Appsecret  string = "iemkUnyvJLghZgkKJBDaB4r4hNlFkab673BO9w6AuU367Rqv5N"
-	Loginuri   string = "/platform/application/login"
-	Refreshuri string = "/platform/application/update_token"
-	Timeover   int64  = 5
-	Timeout    int64  = 10
-	Restfuluri string = "/platform/report/restful"
-	Serviceuri string = "/platform/report/service"
-	Deviceuri  string = "/platform/report/device"
+	Timeover int64 = 5
+	Timeout  int64 = 10
 )
 
-func Test_GetNet(t *testing.T) {
-	loginData := fmt.Sprintf("appid=%s&appsecret=%s&apptype=%s", Appid, Appsecret, "hospital")
-	NewNetClient(&Config{
-		Appid:      Appid,
-		AppSecret:  Appsecret,
-		LoginUrl:   Host + Loginuri,
-		RefreshUrl: Host + Refreshuri,
-		LoginData:  loginData,
+// newPlatformClient 使用 nettest 模拟平台重新初始化 NetClient
+func newPlatformClient(t *testing.T) *nettest.Server {
+	srv := nettest.NewServer()
+	t.Cleanup(srv.Close)
+	NetClient = nil
+	err := NewNetClient(&Config{
+		Appid:      srv.Appid,
+		AppSecret:  srv.AppSecret,
+		LoginUrl:   srv.LoginURL(),
+		RefreshUrl: srv.RefreshURL(),
+		LoginData:  srv.LoginData(),
 		TimeOver:   Timeover,
 		TimeOut:    Timeout,
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func Test_GetNet(t *testing.T) {
+	srv := newPlatformClient(t)
 
 	serviceResponseRestful := &ServerResponse{
-		FullPath:     Host + "/platform/report/getRestful",
+		FullPath:     srv.ReportURL("getRestful"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
 
 	serviceResponseService := &ServerResponse{
-		FullPath:     Host + "/platform/report/getService",
+		FullPath:     srv.ReportURL("getService"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
 	serviceResponseDevice := &ServerResponse{
-		FullPath:     Host + "/platform/report/getDevice",
+		FullPath:     srv.ReportURL("getDevice"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
@@ -79,29 +93,20 @@ func Test_GetNet(t *testing.T) {
 }
 
 func Test_POSTNet(t *testing.T) {
-	loginData := fmt.Sprintf("appid=%s&appsecret=%s&apptype=%s", Appid, Appsecret, "hospital")
-	NewNetClient(&Config{
-		Appid:      Appid,
-		AppSecret:  Appsecret,
-		LoginUrl:   Host + Loginuri,
-		RefreshUrl: Host + Refreshuri,
-		LoginData:  loginData,
-		TimeOver:   Timeover,
-		TimeOut:    Timeout,
-	})
+	srv := newPlatformClient(t)
 	serviceResponseRestful := &ServerResponse{
-		FullPath:     Host + Restfuluri,
+		FullPath:     srv.ReportURL("restful"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
 
 	serviceResponseService := &ServerResponse{
-		FullPath:     Host + Serviceuri,
+		FullPath:     srv.ReportURL("service"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
 	serviceResponseDevice := &ServerResponse{
-		FullPath:     Host + Deviceuri,
+		FullPath:     srv.ReportURL("device"),
 		Auth:         true,
 		ResponseInfo: &ResponseInfo{},
 	}
@@ -171,13 +176,118 @@ func Test_NewNetClient(t *testing.T) {
 			Headers:     nil, // request headers
 		},
 	}
+	saved := NetClient
+	defer func() { NetClient = saved }()
 	for _, arg := range args {
-		t.Run("new redis client", func(t *testing.T) {
+		t.Run("new "+arg.TokenDriver+" client", func(t *testing.T) {
+			if arg.TokenDriver == "redis" {
+				conn, err := stdnet.DialTimeout("tcp", arg.Host, time.Second)
+				if err != nil {
+					t.Skipf("redis %s is not available: %v", arg.Host, err)
+				}
+				conn.Close()
+			}
+			NetClient = nil
 			err := NewNetClient(arg)
 			if err != nil {
 				t.Errorf("redis ping is fault,get msg %s", err.Error())
 			}
 		})
 	}
+}
+
+func Test_GetNetContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
 
+	client := &Client{Config: &Config{TimeOver: 10, TimeOut: 10}, TokenClient: &token.LocalClient{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetNetContext(ctx, &ServerResponse{FullPath: ts.URL, ResponseInfo: &ResponseInfo{}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetNetContext() error = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("GetNetContext() was not canceled in time")
+	}
+}
+
+func Test_ReplayAfterTokenRecovery(t *testing.T) {
+	var logins, uploads int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":{"AccessToken":"token-%d"}}`, logins)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		if r.Header.Get("X-Token") != "token-1" {
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			fmt.Fprintf(w, `{"code":500,"message":"%s"}`, err)
+			return
+		}
+		defer file.Close()
+		b, _ := io.ReadAll(file)
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":"%s"}`, b)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &Client{
+		Config:      &Config{Appid: "replay", LoginUrl: ts.URL + "/login", TimeOver: 5, TimeOut: 5},
+		TokenClient: &token.LocalClient{AppID: "replay"},
+	}
+	client.TokenClient.GetCache()
+	client.TokenClient.SetCacheToken("")
+
+	sr := &ServerResponse{FullPath: ts.URL + "/upload", Auth: true, ResponseInfo: &ResponseInfo{}}
+	_, err := client.Upload(sr, "file", "a.txt", nil, strings.NewReader("content"))
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if uploads != 2 || logins != 1 {
+		t.Errorf("Upload() uploads = %d logins = %d, want 2 and 1", uploads, logins)
+	}
+	if sr.ResponseInfo.Data != "content" {
+		t.Errorf("Upload() replayed data = %v, want content", sr.ResponseInfo.Data)
+	}
+}
+
+func Test_New(t *testing.T) {
+	headers := map[string]string{"X-Platform": "a"}
+	a, err := New(&Config{Appid: "a", TokenDriver: "local", Headers: headers})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	b, err := New(&Config{Appid: "b", TokenDriver: "local", Proxy: "http://127.0.0.1:8080"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	headers["X-Platform"] = "changed"
+
+	a.TokenClient.SetCacheToken("token-a")
+	if got := b.TokenClient.GetCacheToken(); got != "" {
+		t.Errorf("client b token = %q, want empty", got)
+	}
+	if a.Transport == b.Transport {
+		t.Errorf("clients share the same transport")
+	}
+	if got := a.Config.Headers["X-Platform"]; got != "a" {
+		t.Errorf("client a header = %q, want a", got)
+	}
+
+	if _, err := New(&Config{TokenDriver: "redis"}); err == nil {
+		t.Errorf("New() redis driver without host should return error")
+	}
 }
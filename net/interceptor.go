@@ -0,0 +1,119 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Call 一次请求和返回，拦截器可以读取和修改
+type Call struct {
+	Request  *http.Request
+	Response *http.Response // 为 nil 表示请求未得到响应
+	Body     []byte         // 返回内容，下载文件时为空，由调用方读取 Response.Body
+	Result   *Result        // Envelope 解析结果，GetFile 和下载文件时为空
+
+	readBody bool
+	decode   bool
+	cache    bool // 只有 GetNet 请求可以缓存
+}
+
+// StatusCode http 状态码，请求未得到响应时为 0
+func (c *Call) StatusCode() int {
+	if c.Response == nil {
+		return 0
+	}
+	return c.Response.StatusCode
+}
+
+// Handler 发送请求，返回后 Call 中已填充 Response，Body 和 Result
+type Handler func(call *Call) error
+
+// Interceptor 请求拦截器，调用 next 继续发送请求，可以在 next 前修改 Call.Request，
+// 在 next 后读取 Call.Response，Call.Body 和 Call.Result，不调用 next 可以直接返回结果
+type Interceptor func(call *Call, next Handler) error
+
+// invoke 依次通过 Config.Interceptors 发送请求，第一个拦截器在最外层
+// 内置的链路追踪，缓存，限流，熔断，签名，调试记录和统计依次在所有拦截器之后，发送请求之前
+func (n *Client) invoke(call *Call) error {
+	var handler Handler = n.roundTrip
+	if n.Config.Metrics != nil {
+		handler = chain(n.metricsInterceptor, handler)
+	}
+	if n.Config.Debug != nil {
+		handler = chain(n.debugInterceptor, handler)
+	}
+	if n.Config.Sign {
+		handler = chain(n.signInterceptor, handler)
+	}
+	if n.Config.Breaker != nil {
+		handler = chain(n.breakerInterceptor, handler)
+	}
+	if n.Config.Limit != nil {
+		handler = chain(n.limitInterceptor, handler)
+	}
+	if n.Config.Cache != nil {
+		handler = chain(n.cacheInterceptor, handler)
+	}
+	if n.Config.Trace != nil {
+		handler = chain(n.traceInterceptor, handler)
+	}
+	for i := len(n.Config.Interceptors) - 1; i >= 0; i-- {
+		handler = chain(n.Config.Interceptors[i], handler)
+	}
+	return handler(call)
+}
+
+func chain(interceptor Interceptor, next Handler) Handler {
+	return func(call *Call) error {
+		return interceptor(call, next)
+	}
+}
+
+// roundTrip 发送请求，读取并解析返回内容，超时由请求的 ctx 控制
+func (n *Client) roundTrip(call *Call) error {
+	req := call.Request
+	resp, err := n.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, wrapTimeout(req.Context(), err))
+	}
+	call.Response = resp
+	if !call.readBody {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	call.Body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, wrapTimeout(req.Context(), err))
+	}
+	// 304 由 cacheInterceptor 使用缓存内容解析
+	if !call.decode || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	return n.decode(call)
+}
+
+// decode 按 Envelope 解析返回内容，是否接受空内容由 Envelope 决定
+func (n *Client) decode(call *Call) error {
+	req := call.Request
+	var err error
+	call.Result, err = n.envelope().Decode(call.StatusCode(), call.Body)
+	if errors.Is(err, ErrEmptyResponse) {
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, ErrEmptyResponse)
+	}
+	if err != nil {
+		return &DecodeError{Method: req.Method, Path: req.URL.String(), Status: call.StatusCode(), Body: call.Body, Err: err}
+	}
+	call.Result.Status = call.StatusCode()
+	return nil
+}
+
+// client 使用 New 创建的 http.Client，直接构造的 Client 使用 Transport
+func (n *Client) client() *http.Client {
+	if n.httpClient != nil {
+		return n.httpClient
+	}
+	return &http.Client{Transport: n.Transport}
+}
@@ -0,0 +1,59 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chindeo/pkg/net/token"
+)
+
+func Test_Interceptors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"code":200,"message":"%s"}`, r.Header.Get("X-Sign"))
+	}))
+	defer ts.Close()
+
+	var order []string
+	var xToken, message string
+	errFault := errors.New("fault")
+	client := &Client{
+		Config: &Config{Appid: "interceptor", Interceptors: []Interceptor{
+			func(call *Call, next Handler) error {
+				order = append(order, "outer")
+				xToken = call.Request.Header.Get("X-Token")
+				err := next(call)
+				if call.Result != nil {
+					message = call.Result.Message
+				}
+				return err
+			},
+			func(call *Call, next Handler) error {
+				order = append(order, "inner")
+				if call.Request.URL.Path == "/fault" {
+					return errFault
+				}
+				call.Request.Header.Set("X-Sign", "signed")
+				return next(call)
+			},
+		}},
+		TokenClient: &token.LocalClient{AppID: "interceptor"},
+	}
+	client.TokenClient.GetCache()
+	client.TokenClient.SetCacheToken("token")
+
+	_, err := client.GetNet(&ServerResponse{FullPath: ts.URL, Auth: true})
+	if err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if fmt.Sprint(order) != "[outer inner]" || xToken != "token" || message != "signed" {
+		t.Errorf("order = %v xToken = %q message = %q", order, xToken, message)
+	}
+
+	_, err = client.GetNet(&ServerResponse{FullPath: ts.URL + "/fault"})
+	if !errors.Is(err, errFault) {
+		t.Errorf("GetNet() error = %v, want fault", err)
+	}
+}
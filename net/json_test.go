@@ -0,0 +1,60 @@
+package net
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_SendJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+			w.Write([]byte(`{"code":415,"message":"content type"}`))
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    200,
+			"message": r.Method,
+			"data":    json.RawMessage(b),
+		})
+	}))
+	defer ts.Close()
+
+	type device struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	client := &Client{Config: &Config{TimeOver: 5, TimeOut: 5}}
+
+	tests := []struct {
+		name string
+		send func(sr *ServerResponse, payload interface{}) ([]byte, error)
+		want string
+	}{
+		{name: "POST", send: client.PostJSON, want: http.MethodPost},
+		{name: "PUT", send: client.PutJSON, want: http.MethodPut},
+		{name: "PATCH", send: client.PatchJSON, want: http.MethodPatch},
+		{name: "DELETE", send: client.DeleteJSON, want: http.MethodDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &device{}
+			sr := &ServerResponse{FullPath: ts.URL, Data: got}
+			_, err := tt.send(sr, device{Name: "nis", Port: 8080})
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if sr.ResponseInfo.Message != tt.want || got.Name != "nis" || got.Port != 8080 {
+				t.Errorf("got %s %+v", sr.ResponseInfo.Message, got)
+			}
+
+			again := &device{}
+			if err := sr.ResponseInfo.DecodeData(again); err != nil || *again != *got {
+				t.Errorf("DecodeData() = %+v, %v", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited 超过请求频率或同时请求数限制，LimitPolicy.Reject 为 true 时返回
+var ErrRateLimited = errors.New("请求过于频繁")
+
+// LimitPolicy 客户端限流，整个 Client 和每个目标主机分别计算，0 表示不限制
+type LimitPolicy struct {
+	Rate               float64 // 每秒请求数
+	Burst              int     // 允许的突发请求数，默认 1
+	HostRate           float64 // 每个主机每秒请求数
+	HostBurst          int     // 每个主机允许的突发请求数，默认 1
+	MaxInFlight        int     // 同时进行的请求数
+	MaxInFlightPerHost int     // 每个主机同时进行的请求数
+	Reject             bool    // 超过限制时直接返回 ErrRateLimited，默认排队等待直到 ctx 结束
+}
+
+// limiter 令牌桶和同时请求数限制
+type limiter struct {
+	bucket *bucket
+	sem    chan struct{}
+}
+
+func newLimiter(rate float64, burst, inFlight int) *limiter {
+	l := &limiter{}
+	if rate > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		l.bucket = &bucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+	}
+	if inFlight > 0 {
+		l.sem = make(chan struct{}, inFlight)
+	}
+	return l
+}
+
+// acquire 获取令牌和请求名额，返回释放名额的函数
+func (l *limiter) acquire(ctx context.Context, reject bool) (func(), error) {
+	if l.bucket != nil {
+		err := l.bucket.wait(ctx, reject)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	if reject {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			return nil, ErrRateLimited
+		}
+	} else {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.sem })
+	}, nil
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// wait 取一个令牌，没有令牌时 reject 为 true 直接返回，否则预约令牌并等待
+func (b *bucket) wait(ctx context.Context, reject bool) error {
+	b.mu.Lock()
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+	if reject {
+		b.mu.Unlock()
+		return ErrRateLimited
+	}
+	delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	b.tokens--
+	b.mu.Unlock()
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// 归还预约的令牌
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (n *Client) limiter(host string) *limiter {
+	if l, ok := n.limiters.Load(host); ok {
+		return l.(*limiter)
+	}
+	p := n.Config.Limit
+	l := newLimiter(p.HostRate, p.HostBurst, p.MaxInFlightPerHost)
+	if host == "" {
+		l = newLimiter(p.Rate, p.Burst, p.MaxInFlight)
+	}
+	actual, _ := n.limiters.LoadOrStore(host, l)
+	return actual.(*limiter)
+}
+
+// limitInterceptor 按 Config.Limit 限制请求频率和同时请求数
+func (n *Client) limitInterceptor(call *Call, next Handler) error {
+	p := n.Config.Limit
+	req := call.Request
+	ctx := req.Context()
+
+	// key "" 为整个 Client 的限制
+	releaseClient, err := n.limiter("").acquire(ctx, p.Reject)
+	if err != nil {
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, err)
+	}
+	releaseHost, err := n.limiter(req.URL.Host).acquire(ctx, p.Reject)
+	if err != nil {
+		releaseClient()
+		return fmt.Errorf("[%s] %s %w", req.Method, req.URL, err)
+	}
+	release := func() {
+		releaseHost()
+		releaseClient()
+	}
+
+	err = next(call)
+	// 下载文件时读取完返回内容才释放名额
+	if err == nil && !call.readBody && call.Response != nil {
+		call.Response.Body = &releaseBody{ReadCloser: call.Response.Body, release: release}
+		return nil
+	}
+	release()
+	return err
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
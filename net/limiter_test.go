@@ -0,0 +1,56 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Limit(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	t.Run("rate", func(t *testing.T) {
+		client := &Client{Config: &Config{Limit: &LimitPolicy{Rate: 20, Burst: 1}}}
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL}); err != nil {
+				t.Fatalf("GetNet() error = %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Errorf("3 requests at 20/s took %s, want >= 100ms", elapsed)
+		}
+	})
+
+	t.Run("max in flight", func(t *testing.T) {
+		client := &Client{Config: &Config{Limit: &LimitPolicy{MaxInFlightPerHost: 1, Reject: true}}}
+		done := make(chan error)
+		go func() {
+			_, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/slow"})
+			done <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		_, err := client.GetNet(&ServerResponse{FullPath: ts.URL})
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("GetNet() error = %v, want ErrRateLimited", err)
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Errorf("slow GetNet() error = %v", err)
+		}
+		if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL}); err != nil {
+			t.Errorf("GetNet() after release error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package net
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets 请求耗时分布，秒
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets 返回内容大小分布，字节
+	DefaultSizeBuckets = []float64{128, 512, 1024, 4096, 16384, 65536, 262144, 1048576}
+)
+
+// Metrics 按接口路径统计请求数，耗时，返回大小，响应 code 和 token 登录刷新次数，
+// 实现 http.Handler 以 Prometheus 文本格式输出，多个 Client 可以共用一个 Metrics
+type Metrics struct {
+	LatencyBuckets []float64                  // 为空时使用 DefaultLatencyBuckets
+	SizeBuckets    []float64                  // 为空时使用 DefaultSizeBuckets
+	PathLabel      func(*http.Request) string // 接口路径标签，默认 URL.Path，路径中带 id 时可以合并
+
+	once      sync.Once
+	mu        sync.Mutex
+	requests  *counterVec
+	codes     *counterVec
+	tokens    *counterVec
+	durations *histogramVec
+	sizes     *histogramVec
+	queues    map[string]*diskQueue // 离线队列目录 -> 队列
+}
+
+// NewMetrics 使用默认分布创建 Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) init() {
+	m.once.Do(func() {
+		latency, size := m.LatencyBuckets, m.SizeBuckets
+		if len(latency) == 0 {
+			latency = DefaultLatencyBuckets
+		}
+		if len(size) == 0 {
+			size = DefaultSizeBuckets
+		}
+		m.requests = newCounterVec("net_client_requests_total", "Requests sent by net.Client.", "method", "path", "status")
+		m.codes = newCounterVec("net_client_envelope_codes_total", "Envelope codes returned by the platform.", "method", "path", "code")
+		m.tokens = newCounterVec("net_client_token_total", "Token logins and refreshes.", "path", "op", "result")
+		m.durations = newHistogramVec("net_client_request_duration_seconds", "Request latency including reading the body.", latency, "method", "path")
+		m.sizes = newHistogramVec("net_client_response_size_bytes", "Response body size.", size, "method", "path")
+	})
+}
+
+func (m *Metrics) path(req *http.Request) string {
+	if m.PathLabel != nil {
+		return m.PathLabel(req)
+	}
+	if req.URL.Path == "" {
+		return "/"
+	}
+	return req.URL.Path
+}
+
+// observe 记录一次请求，未得到响应时 status 为 error
+func (m *Metrics) observe(call *Call, elapsed time.Duration) {
+	m.init()
+	req := call.Request
+	method, path := req.Method, m.path(req)
+	status := "error"
+	if call.Response != nil {
+		status = strconv.Itoa(call.Response.StatusCode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests.inc(method, path, status)
+	m.durations.observe(elapsed.Seconds(), method, path)
+	if call.Response != nil && call.readBody {
+		m.sizes.observe(float64(len(call.Body)), method, path)
+	}
+	if call.Result != nil {
+		m.codes.inc(method, path, strconv.Itoa(call.Result.Code))
+	}
+}
+
+// observeToken 记录 token 登录或刷新，op 为 login 或 refresh
+func (m *Metrics) observeToken(url, op string, err error) {
+	m.init()
+	path := url
+	if req, e := http.NewRequest(http.MethodGet, url, nil); e == nil {
+		path = m.path(req)
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens.inc(path, op, result)
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo 以 Prometheus 文本格式写入 w
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	m.requests.write(&sb)
+	m.durations.write(&sb)
+	m.sizes.write(&sb)
+	m.codes.write(&sb)
+	m.tokens.write(&sb)
+	m.writeQueues(&sb)
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (m *Metrics) registerQueue(dir string, q *diskQueue) {
+	m.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queues == nil {
+		m.queues = map[string]*diskQueue{}
+	}
+	m.queues[dir] = q
+}
+
+// writeQueues 输出离线队列积压和丢弃数，调用时需持有 mu
+func (m *Metrics) writeQueues(sb *strings.Builder) {
+	if len(m.queues) == 0 {
+		return
+	}
+	depth := newCounterVec("net_client_queue_depth", "Reports waiting in the offline queue.", "queue")
+	size := newCounterVec("net_client_queue_bytes", "Bytes waiting in the offline queue.", "queue")
+	replayed := newCounterVec("net_client_queue_replayed_total", "Queued reports delivered after reconnecting.", "queue")
+	dropped := newCounterVec("net_client_queue_dropped_total", "Queued reports dropped by size, age, rejected or corrupt.", "queue", "reason")
+	for dir, q := range m.queues {
+		stats := q.stats()
+		depth.add(float64(stats.Depth), dir)
+		size.add(float64(stats.Bytes), dir)
+		replayed.add(float64(stats.Replayed), dir)
+		for reason, count := range stats.Dropped {
+			dropped.add(float64(count), dir, reason)
+		}
+	}
+	depth.kind, size.kind = "gauge", "gauge"
+	depth.write(sb)
+	size.write(sb)
+	replayed.write(sb)
+	dropped.write(sb)
+}
+
+// metricsInterceptor 在调试记录之后记录实际发送的请求，重试时每次请求单独记录
+func (n *Client) metricsInterceptor(call *Call, next Handler) error {
+	start := time.Now()
+	err := next(call)
+	n.Config.Metrics.observe(call, time.Since(start))
+	return err
+}
+
+// observeToken 未配置 Metrics 时不记录
+func (n *Client) observeToken(url, op string, err error) {
+	if n.Config.Metrics != nil {
+		n.Config.Metrics.observeToken(url, op, err)
+	}
+}
+
+type counterVec struct {
+	name, help string
+	kind       string // 默认 counter，输出瞬时值时为 gauge
+	labels     []string
+	values     map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]*counterValue{}}
+}
+
+func (c *counterVec) inc(labels ...string) {
+	c.add(1, labels...)
+}
+
+func (c *counterVec) add(delta float64, labels ...string) {
+	key := strings.Join(labels, "\xff")
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: labels}
+		c.values[key] = v
+	}
+	v.value += delta
+}
+
+func (c *counterVec) write(sb *strings.Builder) {
+	kind := c.kind
+	if kind == "" {
+		kind = "counter"
+	}
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, kind)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := c.values[key]
+		fmt.Fprintf(sb, "%s%s %s\n", c.name, formatLabels(c.labels, v.labels), formatFloat(v.value))
+	}
+}
+
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	values     map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // 每个区间的数量，不累加
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramValue{}}
+}
+
+func (h *histogramVec) observe(value float64, labels ...string) {
+	key := strings.Join(labels, "\xff")
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{labels: labels, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		v.counts[i]++
+	}
+	v.count++
+	v.sum += value
+}
+
+func (h *histogramVec) write(sb *strings.Builder) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	names := append(append([]string(nil), h.labels...), "le")
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += v.counts[i]
+			values := append(append([]string(nil), v.labels...), formatFloat(bound))
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", h.name, formatLabels(names, values), cumulative)
+		}
+		values := append(append([]string(nil), v.labels...), "+Inf")
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", h.name, formatLabels(names, values), v.count)
+		fmt.Fprintf(sb, "%s_sum%s %s\n", h.name, formatLabels(h.labels, v.labels), formatFloat(v.sum))
+		fmt.Fprintf(sb, "%s_count%s %d\n", h.name, formatLabels(h.labels, v.labels), v.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
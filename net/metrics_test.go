@@ -0,0 +1,66 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chindeo/pkg/net/nettest"
+)
+
+func Test_Metrics(t *testing.T) {
+	srv := nettest.NewServer()
+	defer srv.Close()
+
+	metrics := &Metrics{LatencyBuckets: []float64{1, 0.1}}
+	client, err := New(&Config{
+		Appid:       srv.Appid,
+		LoginUrl:    srv.LoginURL(),
+		RefreshUrl:  srv.RefreshURL(),
+		LoginData:   srv.LoginData(),
+		TokenDriver: "local",
+		Metrics:     metrics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.POSTNet(&ServerResponse{FullPath: srv.ReportURL("service"), Auth: true}, "fault_data=1"); err != nil {
+			t.Fatalf("POSTNet() error = %v", err)
+		}
+		srv.Script(nettest.ReportPath+"service", nettest.Response{Code: 402, Message: "refresh token"})
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	for _, want := range []string{
+		"# TYPE net_client_requests_total counter",
+		`net_client_requests_total{method="POST",path="/platform/report/service",status="200"} 4`,
+		`net_client_requests_total{method="POST",path="/platform/application/login",status="200"} 1`,
+		`net_client_request_duration_seconds_bucket{method="POST",path="/platform/report/service",le="0.1"} 4`,
+		`net_client_request_duration_seconds_bucket{method="POST",path="/platform/report/service",le="+Inf"} 4`,
+		`net_client_request_duration_seconds_count{method="POST",path="/platform/report/service"} 4`,
+		`net_client_response_size_bytes_count{method="POST",path="/platform/report/service"} 4`,
+		`net_client_envelope_codes_total{method="POST",path="/platform/report/service",code="200"} 2`,
+		`net_client_envelope_codes_total{method="POST",path="/platform/report/service",code="401"} 1`,
+		`net_client_envelope_codes_total{method="POST",path="/platform/report/service",code="402"} 1`,
+		`net_client_token_total{path="/platform/application/login",op="login",result="success"} 1`,
+		`net_client_token_total{path="/platform/application/update_token",op="refresh",result="success"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics does not contain %s\n%s", want, out)
+		}
+	}
+}
+
+func Test_FormatLabels(t *testing.T) {
+	got := formatLabels([]string{"path"}, []string{"a\"b\\c\nd"})
+	if want := `{path="a\"b\\c\nd"}`; got != want {
+		t.Errorf("formatLabels() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,254 @@
+// Package nettest 基于 httptest 模拟平台接口，测试不需要访问真实平台
+//
+//	srv := nettest.NewServer()
+//	defer srv.Close()
+//	client, _ := net.New(&net.Config{
+//		Appid:      srv.Appid,
+//		LoginUrl:   srv.LoginURL(),
+//		RefreshUrl: srv.RefreshURL(),
+//		LoginData:  srv.LoginData(),
+//	})
+package nettest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LoginPath   = "/platform/application/login"
+	RefreshPath = "/platform/application/update_token"
+	ReportPath  = "/platform/report/"
+)
+
+// Response 预设响应，零值返回 code 200
+type Response struct {
+	Status  int           // http 状态码，0 表示 200
+	Code    int           // 响应 code，0 表示 200
+	Message string        // 为空时使用 ok
+	Data    interface{}   // 响应 data
+	Delay   time.Duration // 延迟返回，请求取消时立即结束
+	Empty   bool          // 返回空响应体
+	Drop    bool          // 直接关闭连接不返回响应，模拟网络中断
+}
+
+// Report 收到的上报请求
+type Report struct {
+	Method string
+	Path   string
+	Token  string
+	Header http.Header
+	Form   url.Values
+	Body   []byte
+}
+
+// Server 模拟平台的登录、刷新 token 和上报接口
+//
+// 登录校验 appid 和 appsecret 并返回新 token，刷新接口校验当前 token 后返回新 token，
+// 上报接口 ReportPath 下的所有路径都校验 X-Token，token 不正确时返回 401
+type Server struct {
+	*httptest.Server
+
+	Appid     string
+	AppSecret string
+	TokenTTL  time.Duration // 大于 0 时登录返回 ExpiresIn
+
+	mu        sync.Mutex
+	token     string
+	seq       int
+	logins    int
+	refreshes int
+	scripts   map[string][]Response
+	reports   []Report
+}
+
+// NewServer 启动模拟平台，使用后调用 Close
+func NewServer() *Server {
+	s := &Server{
+		Appid:     "nettest-appid",
+		AppSecret: "nettest-appsecret",
+		scripts:   map[string][]Response{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(LoginPath, s.login)
+	mux.HandleFunc(RefreshPath, s.refresh)
+	mux.HandleFunc(ReportPath, s.report)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if resp, ok := s.next(r.URL.Path); ok {
+			s.write(w, r, resp)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// LoginURL 登录接口地址
+func (s *Server) LoginURL() string {
+	return s.URL + LoginPath
+}
+
+// RefreshURL 刷新 token 接口地址
+func (s *Server) RefreshURL() string {
+	return s.URL + RefreshPath
+}
+
+// ReportURL 上报接口地址，例如 ReportURL("restful")
+func (s *Server) ReportURL(name string) string {
+	return s.URL + ReportPath + strings.TrimPrefix(name, "/")
+}
+
+// LoginData 登录参数
+func (s *Server) LoginData() string {
+	return url.Values{"appid": {s.Appid}, "appsecret": {s.AppSecret}, "apptype": {"hospital"}}.Encode()
+}
+
+// Token 当前有效的 token，未登录时为空
+func (s *Server) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// ExpireToken 让当前 token 失效，之后的上报返回 401，直到重新登录
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
+
+// Script 设置 path 接下来的响应，按顺序每个请求使用一个，用完后恢复默认处理
+func (s *Server) Script(path string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[path] = append(s.scripts[path], responses...)
+}
+
+// Logins 登录成功次数
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Refreshes 刷新 token 成功次数
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// Reports 通过校验的上报请求
+func (s *Server) Reports() []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Report(nil), s.reports...)
+}
+
+func (s *Server) next(path string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.scripts[path]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+	s.scripts[path] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("appid") != s.Appid || r.FormValue("appsecret") != s.AppSecret {
+		s.write(w, r, Response{Code: 403, Message: "appid or appsecret error"})
+		return
+	}
+	s.mu.Lock()
+	s.logins++
+	data := s.issue()
+	s.mu.Unlock()
+	s.write(w, r, Response{Data: data})
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.token == "" || r.Header.Get("X-Token") != s.token {
+		s.mu.Unlock()
+		s.write(w, r, Response{Code: 401, Message: "token invalid"})
+		return
+	}
+	s.refreshes++
+	data := s.issue()
+	s.mu.Unlock()
+	s.write(w, r, Response{Data: data})
+}
+
+// issue 生成新 token，调用时需持有 mu
+func (s *Server) issue() map[string]interface{} {
+	s.seq++
+	s.token = fmt.Sprintf("token-%d", s.seq)
+	data := map[string]interface{}{"AccessToken": s.token}
+	if s.TokenTTL > 0 {
+		data["ExpiresIn"] = int64(s.TokenTTL / time.Second)
+	}
+	return data
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	xToken := r.Header.Get("X-Token")
+
+	s.mu.Lock()
+	if s.token == "" || xToken != s.token {
+		s.mu.Unlock()
+		s.write(w, r, Response{Code: 401, Message: "token invalid"})
+		return
+	}
+	s.reports = append(s.reports, Report{Method: r.Method, Path: r.URL.Path, Token: xToken, Header: r.Header.Clone(), Form: form, Body: body})
+	s.mu.Unlock()
+	s.write(w, r, Response{Data: []interface{}{}})
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, resp Response) {
+	if resp.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	if resp.Delay > 0 {
+		// 读完请求体后 http.Server 才能发现连接关闭并取消 r.Context
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(resp.Delay):
+		}
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.Empty {
+		w.WriteHeader(status)
+		return
+	}
+	code, message := resp.Code, resp.Message
+	if code == 0 {
+		code = 200
+	}
+	if message == "" {
+		message = "ok"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message, "data": resp.Data})
+}
@@ -0,0 +1,87 @@
+package nettest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net"
+	"github.com/chindeo/pkg/net/nettest"
+)
+
+func newClient(t *testing.T, srv *nettest.Server) *net.Client {
+	client, err := net.New(&net.Config{
+		Appid:       srv.Appid,
+		LoginUrl:    srv.LoginURL(),
+		RefreshUrl:  srv.RefreshURL(),
+		LoginData:   srv.LoginData(),
+		TimeOver:    1,
+		TimeOut:     1,
+		TokenDriver: "local",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func Test_Server(t *testing.T) {
+	srv := nettest.NewServer()
+	defer srv.Close()
+	client := newClient(t, srv)
+	report := func() error {
+		_, err := client.POSTNet(&net.ServerResponse{FullPath: srv.ReportURL("service"), Auth: true}, "fault_data=1")
+		return err
+	}
+
+	if err := report(); err != nil {
+		t.Fatalf("POSTNet() error = %v", err)
+	}
+	if srv.Logins() != 1 || len(srv.Reports()) != 1 || srv.Reports()[0].Form.Get("fault_data") != "1" {
+		t.Fatalf("logins = %d reports = %v", srv.Logins(), srv.Reports())
+	}
+
+	srv.ExpireToken()
+	if err := report(); err != nil {
+		t.Fatalf("POSTNet() after ExpireToken error = %v", err)
+	}
+	if srv.Logins() != 2 {
+		t.Errorf("logins after ExpireToken = %d, want 2", srv.Logins())
+	}
+
+	srv.Script(nettest.ReportPath+"service", nettest.Response{Code: 402, Message: "refresh token"})
+	if err := report(); err != nil {
+		t.Fatalf("POSTNet() after 402 error = %v", err)
+	}
+	if srv.Refreshes() != 1 || client.TokenClient.GetCacheToken() != srv.Token() {
+		t.Errorf("refreshes = %d token = %s, want 1 and %s", srv.Refreshes(), client.TokenClient.GetCacheToken(), srv.Token())
+	}
+
+	srv.Script(nettest.ReportPath+"service", nettest.Response{Empty: true})
+	if err := report(); !errors.Is(err, net.ErrEmptyResponse) {
+		t.Errorf("POSTNet() empty body error = %v, want ErrEmptyResponse", err)
+	}
+
+	srv.Script(nettest.ReportPath+"service", nettest.Response{Delay: 3 * time.Second})
+	if err := report(); !errors.Is(err, net.ErrTimeout) {
+		t.Errorf("POSTNet() slow error = %v, want ErrTimeout", err)
+	}
+
+	if err := report(); err != nil {
+		t.Errorf("POSTNet() after script error = %v", err)
+	}
+}
+
+func Test_ServerLoginFailed(t *testing.T) {
+	srv := nettest.NewServer()
+	defer srv.Close()
+	srv.AppSecret = "changed"
+	client := newClient(t, srv)
+	client.Config.LoginData = "appid=" + srv.Appid + "&appsecret=wrong"
+
+	_, err := client.GetNet(&net.ServerResponse{FullPath: srv.ReportURL("getService"), Auth: true})
+	var apiErr *net.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		t.Errorf("GetNet() error = %v, want APIError 403", err)
+	}
+}
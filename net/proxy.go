@@ -0,0 +1,147 @@
+package net
+
+import (
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyRule 代理规则，按顺序匹配请求的主机，第一个匹配的规则生效，都不匹配时使用环境变量中的代理
+type ProxyRule struct {
+	URL      string   // 代理地址，支持 http，https 和 socks5，例如 socks5://10.0.0.1:1080
+	Username string   // 代理认证用户名，优先于 URL 中的用户名
+	Password string   // 代理认证密码
+	Hosts    []string // 使用该代理的主机，为空表示所有主机
+	NoProxy  []string // 不使用该代理的主机
+}
+
+// hostMatcher 主机规则，"*" 匹配所有主机，"10.0.0.0/8" 按 CIDR 匹配 IP 地址，
+// ".chindeo.com" 或 "*.chindeo.com" 匹配所有子域名，"op.chindeo.com"，"10.0.0.1" 精确匹配主机，
+// "op.chindeo.com:8080" 精确匹配主机和端口
+type hostMatcher struct {
+	all      bool
+	cidrs    []*stdnet.IPNet
+	suffixes []string
+	hosts    map[string]bool
+}
+
+func newHostMatcher(patterns []string) (*hostMatcher, error) {
+	m := &hostMatcher{hosts: map[string]bool{}}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "":
+		case p == "*":
+			m.all = true
+		case strings.Contains(p, "/"):
+			_, cidr, err := stdnet.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("proxy host rule %s %w", p, err)
+			}
+			m.cidrs = append(m.cidrs, cidr)
+		case strings.HasPrefix(p, "*."):
+			m.suffixes = append(m.suffixes, p[1:])
+		case strings.HasPrefix(p, "."):
+			m.suffixes = append(m.suffixes, p)
+		default:
+			m.hosts[p] = true
+		}
+	}
+	return m, nil
+}
+
+func (m *hostMatcher) empty() bool {
+	return !m.all && len(m.cidrs) == 0 && len(m.suffixes) == 0 && len(m.hosts) == 0
+}
+
+// match hostport 为 URL.Host，可能带端口
+func (m *hostMatcher) match(hostport string) bool {
+	if m.all {
+		return true
+	}
+	hostport = strings.ToLower(hostport)
+	host := hostport
+	if h, _, err := stdnet.SplitHostPort(hostport); err == nil {
+		host = h
+	} else {
+		// 不带端口的 IPv6 地址，例如 [::1]
+		host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+	}
+	if m.hosts[hostport] || m.hosts[host] {
+		return true
+	}
+	if ip := stdnet.ParseIP(host); ip != nil {
+		for _, cidr := range m.cidrs {
+			if cidr.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, suffix := range m.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyRule struct {
+	url     *url.URL
+	hosts   *hostMatcher
+	noProxy *hostMatcher
+}
+
+// proxyFunc 按 Config.ProxyRules 和 Config.Proxy 为每个请求选择代理，Config.Proxy 作为最后一条规则，
+// 没有规则或都不匹配时使用 fallback，通常是 http.ProxyFromEnvironment
+func proxyFunc(cfg *Config, fallback func(*http.Request) (*url.URL, error)) (func(*http.Request) (*url.URL, error), error) {
+	rules := cfg.ProxyRules
+	if cfg.Proxy != "" {
+		rules = append(rules[:len(rules):len(rules)], ProxyRule{URL: cfg.Proxy})
+	}
+	if len(rules) == 0 {
+		return fallback, nil
+	}
+
+	compiled := make([]*proxyRule, 0, len(rules))
+	for _, rule := range rules {
+		u, err := url.Parse(rule.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy %s %w", rule.URL, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy %s unsupported scheme %q", rule.URL, u.Scheme)
+		}
+		if rule.Username != "" {
+			u.User = url.UserPassword(rule.Username, rule.Password)
+		}
+		hosts, err := newHostMatcher(rule.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		if hosts.empty() {
+			hosts.all = true
+		}
+		noProxy, err := newHostMatcher(rule.NoProxy)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, &proxyRule{url: u, hosts: hosts, noProxy: noProxy})
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		for _, rule := range compiled {
+			if rule.hosts.match(req.URL.Host) && !rule.noProxy.match(req.URL.Host) {
+				return rule.url, nil
+			}
+		}
+		if fallback != nil {
+			return fallback(req)
+		}
+		return nil, nil
+	}, nil
+}
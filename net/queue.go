@@ -0,0 +1,550 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	stdnet "net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chindeo/pkg/logging"
+)
+
+// ErrQueued 平台不可达，POSTNet 的上报已写入离线队列，恢复后按顺序重新发送
+var ErrQueued = errors.New("已写入离线队列")
+
+var errQueueClosed = errors.New("离线队列已关闭")
+
+// IdempotencyKeyHeader 离线队列重新发送时带上的幂等键请求头，平台按此去重
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// QueuePolicy POSTNet 离线队列，网络错误，超时，熔断和限流的上报写入 Dir 下的分段文件，
+// 队列不为空时新的上报直接排在后面，保证平台收到的顺序与上报顺序一致
+type QueuePolicy struct {
+	Dir           string        // 分段文件目录，不存在时创建
+	SegmentSize   int64         // 单个分段文件最大字节数，默认 4MB
+	MaxBytes      int64         // 积压的最大字节数，超出时丢弃最早的上报，默认 64MB
+	MaxAge        time.Duration // 超过时长的上报不再发送，0 表示不限制
+	RetryInterval time.Duration // 平台不可达时重新发送的间隔，默认 10 秒
+}
+
+func (p *QueuePolicy) segmentSize() int64 {
+	if p.SegmentSize <= 0 {
+		return 4 << 20
+	}
+	return p.SegmentSize
+}
+
+func (p *QueuePolicy) maxBytes() int64 {
+	if p.MaxBytes <= 0 {
+		return 64 << 20
+	}
+	return p.MaxBytes
+}
+
+func (p *QueuePolicy) retryInterval() time.Duration {
+	if p.RetryInterval <= 0 {
+		return 10 * time.Second
+	}
+	return p.RetryInterval
+}
+
+// QueueStats 离线队列状态
+type QueueStats struct {
+	Depth    int               // 积压的上报数
+	Bytes    int64             // 积压的字节数
+	Replayed uint64            // 重新发送成功的上报数
+	Dropped  map[string]uint64 // 丢弃的上报数，按原因 size，age，rejected，corrupt 统计
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey 指定 POSTNetContext 的幂等键，离线队列中已有相同键的上报时不会重复写入
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+func idempotencyKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// queueEntry 分段文件中的一行
+type queueEntry struct {
+	Key  string `json:"key"`
+	Time int64  `json:"time"` // 写入时间，unix 纳秒
+	URL  string `json:"url"`
+	Auth bool   `json:"auth"`
+	Data string `json:"data"`
+}
+
+// queueCursor 下一条未发送上报的位置
+type queueCursor struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// diskQueue 分段文件按编号顺序读写，cursor 文件记录已发送的位置，读完的分段文件删除
+type diskQueue struct {
+	p *QueuePolicy
+
+	mu       sync.Mutex
+	segments []int64 // 未删除的分段编号，升序
+	cursor   queueCursor
+	w        *os.File
+	wSize    int64
+	keys     map[string]struct{}
+	depth    int
+	bytes    int64
+	replayed uint64
+	dropped  map[string]uint64
+
+	replaying chan struct{} // 同时只有一个重新发送
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func openQueue(p *QueuePolicy) (*diskQueue, error) {
+	if p.Dir == "" {
+		return nil, errors.New("queue dir is empty")
+	}
+	if err := os.MkdirAll(p.Dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &diskQueue{
+		p:         p,
+		keys:      map[string]struct{}{},
+		dropped:   map[string]uint64{},
+		replaying: make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+
+	files, err := filepath.Glob(filepath.Join(p.Dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(file), ".seg"), 10, 64)
+		if err == nil {
+			q.segments = append(q.segments, id)
+		}
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if b, err := os.ReadFile(q.cursorPath()); err == nil {
+		_ = json.Unmarshal(b, &q.cursor)
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *diskQueue) segmentPath(id int64) string {
+	return filepath.Join(q.p.Dir, fmt.Sprintf("%016d.seg", id))
+}
+
+func (q *diskQueue) cursorPath() string {
+	return filepath.Join(q.p.Dir, "cursor")
+}
+
+// load 删除 cursor 之前的分段，统计积压，截掉最后一个分段中写了一半的行，打开最后一个分段继续写入
+func (q *diskQueue) load() error {
+	for len(q.segments) > 0 && q.segments[0] < q.cursor.Segment {
+		_ = os.Remove(q.segmentPath(q.segments[0]))
+		q.segments = q.segments[1:]
+	}
+	if len(q.segments) == 0 {
+		q.cursor = queueCursor{}
+		return nil
+	}
+	if q.segments[0] != q.cursor.Segment {
+		q.cursor = queueCursor{Segment: q.segments[0]}
+	}
+
+	for i, id := range q.segments {
+		offset := int64(0)
+		if id == q.cursor.Segment {
+			offset = q.cursor.Offset
+		}
+		valid, err := q.scan(id, offset, func(e *queueEntry, size int64) {
+			q.depth++
+			q.bytes += size
+			if e != nil {
+				q.keys[e.Key] = struct{}{}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if i == len(q.segments)-1 {
+			if err := os.Truncate(q.segmentPath(id), valid); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(q.segmentPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			q.w, q.wSize = f, valid
+		}
+	}
+	return nil
+}
+
+// scan 从 offset 开始读取分段中完整的行，无法解析的行 e 为 nil，返回最后一个完整行的结束位置
+func (q *diskQueue) scan(id, offset int64, fn func(e *queueEntry, size int64)) (int64, error) {
+	f, err := os.Open(q.segmentPath(id))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return offset, nil
+		}
+		offset += int64(len(line))
+		e := &queueEntry{}
+		if json.Unmarshal(line, e) != nil {
+			e = nil
+		}
+		fn(e, int64(len(line)))
+	}
+}
+
+// push 写入一条上报，相同幂等键的上报已在队列中时忽略，超出 MaxBytes 时丢弃最早的上报
+func (q *diskQueue) push(e *queueEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.closed:
+		return errQueueClosed
+	default:
+	}
+	if _, ok := q.keys[e.Key]; ok {
+		return nil
+	}
+	if q.w == nil || (q.wSize > 0 && q.wSize+int64(len(line)) > q.p.segmentSize()) {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.w.Write(line); err != nil {
+		return err
+	}
+	if err := q.w.Sync(); err != nil {
+		return err
+	}
+	q.wSize += int64(len(line))
+	q.keys[e.Key] = struct{}{}
+	q.depth++
+	q.bytes += int64(len(line))
+
+	for q.bytes > q.p.maxBytes() && q.depth > 1 {
+		old, next, size, ok := q.peekLocked()
+		if !ok {
+			break
+		}
+		if old != nil {
+			delete(q.keys, old.Key)
+		}
+		q.ackLocked(next, size, "size")
+	}
+	return nil
+}
+
+// rotate 关闭当前分段，新建下一个编号的分段
+func (q *diskQueue) rotate() error {
+	if q.w != nil {
+		if err := q.w.Close(); err != nil {
+			return err
+		}
+	}
+	id := int64(1)
+	if n := len(q.segments); n > 0 {
+		id = q.segments[n-1] + 1
+	}
+	f, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.segments = append(q.segments, id)
+	q.w, q.wSize = f, 0
+	if len(q.segments) == 1 {
+		q.cursor = queueCursor{Segment: id}
+	}
+	return nil
+}
+
+// peek 读取最早的上报，无法解析的行 e 为 nil
+func (q *diskQueue) peek() (*queueEntry, queueCursor, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.peekLocked()
+}
+
+func (q *diskQueue) peekLocked() (*queueEntry, queueCursor, int64, bool) {
+	for q.depth > 0 && len(q.segments) > 0 {
+		var (
+			entry *queueEntry
+			size  int64
+			found bool
+		)
+		f, err := os.Open(q.segmentPath(q.cursor.Segment))
+		if err != nil {
+			return nil, q.cursor, 0, false
+		}
+		if _, err := f.Seek(q.cursor.Offset, io.SeekStart); err == nil {
+			line, err := bufio.NewReader(f).ReadBytes('\n')
+			if err == nil {
+				found, size = true, int64(len(line))
+				entry = &queueEntry{}
+				if json.Unmarshal(line, entry) != nil {
+					entry = nil
+				}
+			}
+		}
+		f.Close()
+		if found {
+			return entry, queueCursor{Segment: q.cursor.Segment, Offset: q.cursor.Offset + size}, size, true
+		}
+		// 当前分段已读完，写入中的分段除外
+		if len(q.segments) == 1 {
+			break
+		}
+		_ = os.Remove(q.segmentPath(q.segments[0]))
+		q.segments = q.segments[1:]
+		q.cursor = queueCursor{Segment: q.segments[0]}
+	}
+	return nil, q.cursor, 0, false
+}
+
+// ack 移动 cursor 到 next，reason 不为空时记为丢弃，
+// 发送期间 push 超出 MaxBytes 已经丢弃这条上报时 cursor 不在 peek 的位置，直接返回
+func (q *diskQueue) ack(e *queueEntry, next queueCursor, size int64, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.cursor != (queueCursor{Segment: next.Segment, Offset: next.Offset - size}) {
+		return
+	}
+	if e != nil {
+		delete(q.keys, e.Key)
+	}
+	q.ackLocked(next, size, reason)
+}
+
+func (q *diskQueue) ackLocked(next queueCursor, size int64, reason string) {
+	q.cursor = next
+	q.depth--
+	q.bytes -= size
+	if reason == "" {
+		q.replayed++
+	} else {
+		q.dropped[reason]++
+	}
+	if b, err := json.Marshal(q.cursor); err == nil {
+		tmp := q.cursorPath() + ".tmp"
+		if os.WriteFile(tmp, b, 0644) == nil {
+			_ = os.Rename(tmp, q.cursorPath())
+		}
+	}
+}
+
+func (q *diskQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped := make(map[string]uint64, len(q.dropped))
+	for reason, count := range q.dropped {
+		dropped[reason] = count
+	}
+	return QueueStats{Depth: q.depth, Bytes: q.bytes, Replayed: q.replayed, Dropped: dropped}
+}
+
+func (q *diskQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth == 0
+}
+
+func (q *diskQueue) close() error {
+	var err error
+	q.closeOnce.Do(func() {
+		close(q.closed)
+		q.wg.Wait()
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.w != nil {
+			err = q.w.Close()
+			q.w = nil
+		}
+	})
+	return err
+}
+
+// queueable 请求没有到达平台或平台暂时不可用，可以稍后重新发送，
+// 只包括连接失败、超时、连接被重置或关闭、熔断、限流和 5xx 响应（代理或网关后面的平台离线时返回 502/503/504），
+// 地址解析失败或不支持的协议重新发送也不会成功
+func queueable(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) && decodeErr.Status >= http.StatusInternalServerError {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status >= http.StatusInternalServerError {
+		return true
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || urlErr.Op == "parse" {
+		return false
+	}
+	var opErr *stdnet.OpError
+	var netErr stdnet.Error
+	return errors.As(err, &opErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// postQueued 离线队列开启时，队列不为空或平台不可达时写入队列
+func (n *Client) postQueued(ctx context.Context, sr *ServerResponse, data string) ([]byte, error) {
+	key := idempotencyKeyFrom(ctx)
+	if key == "" {
+		key = newIdempotencyKey()
+		ctx = WithIdempotencyKey(ctx, key)
+	}
+	entry := &queueEntry{Key: key, URL: sr.FullPath, Auth: sr.Auth, Data: data}
+
+	if !n.queue.empty() {
+		if err := n.enqueue(entry); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("[%s] %s %w", http.MethodPost, sr.FullPath, ErrQueued)
+	}
+	result, err := n.send(ctx, http.MethodPost, sr, formBody(data))
+	if err == nil || !queueable(err) {
+		return result, err
+	}
+	if qerr := n.enqueue(entry); qerr != nil {
+		return result, fmt.Errorf("%v, queue: %w", err, qerr)
+	}
+	return result, fmt.Errorf("%v, %w", err, ErrQueued)
+}
+
+func (n *Client) enqueue(entry *queueEntry) error {
+	entry.Time = time.Now().UnixNano()
+	return n.queue.push(entry)
+}
+
+// replayLoop 按 RetryInterval 重新发送积压的上报，直到 Close
+func (n *Client) replayLoop() {
+	defer n.queue.wg.Done()
+	t := time.NewTicker(n.Config.Queue.retryInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-n.queue.closed:
+			return
+		case <-t.C:
+			_ = n.FlushQueue(context.Background())
+		}
+	}
+}
+
+// FlushQueue 立即按顺序重新发送离线队列中的上报，平台仍不可达时返回错误，剩余的上报留在队列中，
+// 平台拒绝的上报丢弃，未开启离线队列时直接返回
+func (n *Client) FlushQueue(ctx context.Context) error {
+	q := n.queue
+	if q == nil {
+		return nil
+	}
+	select {
+	case q.replaying <- struct{}{}:
+		defer func() { <-q.replaying }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		select {
+		case <-q.closed:
+			return nil
+		default:
+		}
+		e, next, size, ok := q.peek()
+		if !ok {
+			return nil
+		}
+		if e == nil {
+			q.ack(nil, next, size, "corrupt")
+			continue
+		}
+		if age := n.Config.Queue.MaxAge; age > 0 && time.Since(time.Unix(0, e.Time)) > age {
+			q.ack(e, next, size, "age")
+			continue
+		}
+
+		sr := &ServerResponse{FullPath: e.URL, Auth: e.Auth}
+		_, err := n.send(WithIdempotencyKey(ctx, e.Key), http.MethodPost, sr, formBody(e.Data))
+		if err != nil && queueable(err) {
+			return err
+		}
+		if err != nil {
+			logging.For(ctx).Warnw("queued report rejected", "url", e.URL, "key", e.Key, "error", err.Error())
+			q.ack(e, next, size, "rejected")
+			continue
+		}
+		q.ack(e, next, size, "")
+	}
+}
+
+// QueueStats 离线队列状态，未开启时返回零值
+func (n *Client) QueueStats() QueueStats {
+	if n.queue == nil {
+		return QueueStats{}
+	}
+	return n.queue.stats()
+}
+
+// Close 停止重新发送离线队列并关闭分段文件，未开启离线队列时直接返回
+func (n *Client) Close() error {
+	if n.queue == nil {
+		return nil
+	}
+	return n.queue.close()
+}
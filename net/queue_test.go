@@ -0,0 +1,263 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/nettest"
+)
+
+func Test_Queue(t *testing.T) {
+	srv := nettest.NewServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	metrics := NewMetrics()
+	config := &Config{
+		Appid:       srv.Appid,
+		LoginUrl:    srv.LoginURL(),
+		LoginData:   srv.LoginData(),
+		TokenDriver: "local",
+		Queue:       &QueuePolicy{Dir: dir, RetryInterval: time.Hour},
+		Metrics:     metrics,
+	}
+	client, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := func(ctx context.Context, data string) error {
+		_, err := client.POSTNetContext(ctx, &ServerResponse{FullPath: srv.ReportURL("service"), Auth: true}, data)
+		return err
+	}
+
+	srv.Script(nettest.ReportPath+"service", nettest.Response{Drop: true})
+	if err := report(context.Background(), "n=1"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("POSTNet() unreachable error = %v, want ErrQueued", err)
+	}
+	keyed := WithIdempotencyKey(context.Background(), "k2")
+	for i := 0; i < 2; i++ {
+		if err := report(keyed, "n=2"); !errors.Is(err, ErrQueued) {
+			t.Fatalf("POSTNet() with backlog error = %v, want ErrQueued", err)
+		}
+	}
+	if stats := client.QueueStats(); stats.Depth != 2 {
+		t.Fatalf("QueueStats().Depth = %d, want 2", stats.Depth)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后从分段文件恢复积压
+	client, err = New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if stats := client.QueueStats(); stats.Depth != 2 {
+		t.Fatalf("reopened QueueStats().Depth = %d, want 2", stats.Depth)
+	}
+	if err := client.FlushQueue(context.Background()); err != nil {
+		t.Fatalf("FlushQueue() error = %v", err)
+	}
+	reports := srv.Reports()
+	if len(reports) != 2 || reports[0].Form.Get("n") != "1" || reports[1].Form.Get("n") != "2" {
+		t.Fatalf("reports = %v, want n=1 and n=2 in order", reports)
+	}
+	if reports[0].Header.Get(IdempotencyKeyHeader) == "" || reports[1].Header.Get(IdempotencyKeyHeader) != "k2" {
+		t.Errorf("idempotency keys = %q %q", reports[0].Header.Get(IdempotencyKeyHeader), reports[1].Header.Get(IdempotencyKeyHeader))
+	}
+	if stats := client.QueueStats(); stats.Depth != 0 || stats.Replayed != 2 || stats.Bytes != 0 {
+		t.Errorf("QueueStats() = %+v, want empty and 2 replayed", stats)
+	}
+
+	if err := report(context.Background(), "n=3"); err != nil {
+		t.Fatalf("POSTNet() after flush error = %v", err)
+	}
+	if got := len(srv.Reports()); got != 3 {
+		t.Errorf("reports = %d, want 3", got)
+	}
+
+	var sb strings.Builder
+	if _, err := metrics.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE net_client_queue_depth gauge",
+		`net_client_queue_depth{queue="` + dir + `"} 0`,
+		`net_client_queue_replayed_total{queue="` + dir + `"} 2`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("metrics does not contain %s\n%s", want, sb.String())
+		}
+	}
+}
+
+func Test_QueueLimits(t *testing.T) {
+	dir := t.TempDir()
+	p := &QueuePolicy{Dir: dir, SegmentSize: 150, MaxBytes: 450, MaxAge: time.Minute}
+	q, err := openQueue(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).UnixNano()
+	for i, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		e := &queueEntry{Key: key, Time: time.Now().UnixNano(), URL: "http://127.0.0.1:1/report", Data: strings.Repeat("x", 40)}
+		if i == 3 {
+			e.Time = old
+		}
+		if err := q.push(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := q.stats()
+	if stats.Depth != 3 || stats.Dropped["size"] != 3 || stats.Bytes > p.MaxBytes {
+		t.Fatalf("stats = %+v, want 3 left after dropping 3 by size", stats)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(segments) > 4 {
+		t.Errorf("segments = %d, consumed segments are not removed", len(segments))
+	}
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 写了一半的行在重启时截掉
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	last := segments[len(segments)-1]
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"key":"half`)
+	f.Close()
+
+	client := &Client{Config: &Config{Queue: p}}
+	client.queue, err = openQueue(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if stats := client.QueueStats(); stats.Depth != 3 {
+		t.Fatalf("reopened depth = %d, want 3", stats.Depth)
+	}
+	if b, _ := os.ReadFile(last); strings.Contains(string(b), "half") {
+		t.Errorf("partial line was not truncated")
+	}
+
+	// d 已超过 MaxAge 丢弃，e 和 f 发送到不可达的地址后留在队列中
+	err = client.FlushQueue(context.Background())
+	if err == nil || !queueable(err) {
+		t.Fatalf("FlushQueue() error = %v, want transport error", err)
+	}
+	if stats := client.QueueStats(); stats.Depth != 2 || stats.Dropped["age"] != 1 {
+		t.Errorf("stats = %+v, want 2 left after dropping 1 by age", stats)
+	}
+}
+
+func Test_QueueRejectsBadURL(t *testing.T) {
+	client, err := New(&Config{Queue: &QueuePolicy{Dir: t.TempDir(), RetryInterval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for _, u := range []string{"ftp://bad/x", "http://bad host/x"} {
+		_, err := client.POSTNetContext(context.Background(), &ServerResponse{FullPath: u}, "n=1")
+		if err == nil || errors.Is(err, ErrQueued) || queueable(err) {
+			t.Errorf("POSTNetContext(%s) error = %v, want rejected", u, err)
+		}
+	}
+	if stats := client.QueueStats(); stats.Depth != 0 {
+		t.Errorf("depth = %d, want 0", stats.Depth)
+	}
+
+	// 连接失败可以重新发送
+	_, err = client.POSTNetContext(context.Background(), &ServerResponse{FullPath: "http://127.0.0.1:1/report"}, "n=1")
+	if !errors.Is(err, ErrQueued) {
+		t.Errorf("POSTNetContext() unreachable error = %v, want %v", err, ErrQueued)
+	}
+}
+
+func Test_QueueAckAfterDrop(t *testing.T) {
+	p := &QueuePolicy{Dir: t.TempDir(), MaxBytes: 1 << 20}
+	q, err := openQueue(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+	push := func(key string) {
+		e := &queueEntry{Key: key, Time: time.Now().UnixNano(), URL: "http://127.0.0.1:1/report", Data: strings.Repeat("x", 40)}
+		if err := q.push(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push("a")
+	push("b")
+
+	// 发送 a 期间写入 c 超出 MaxBytes，a 被丢弃
+	e, next, size, ok := q.peek()
+	if !ok || e.Key != "a" {
+		t.Fatalf("peek() = %+v, %v", e, ok)
+	}
+	p.MaxBytes = 2*size + size/2
+	push("c")
+	q.ack(e, next, size, "")
+
+	stats := q.stats()
+	if stats.Depth != 2 || stats.Replayed != 0 || stats.Dropped["size"] != 1 {
+		t.Errorf("stats = %+v, want 2 left and a counted once", stats)
+	}
+	if e, _, _, _ := q.peek(); e == nil || e.Key != "b" {
+		t.Errorf("peek() after ack = %+v, want b", e)
+	}
+}
+
+func Test_QueueGatewayError(t *testing.T) {
+	var down int32 = 1
+	var received int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, "<html><body><h1>502 Bad Gateway</h1></body></html>")
+			return
+		}
+		atomic.AddInt32(&received, 1)
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	client, err := New(&Config{Queue: &QueuePolicy{Dir: t.TempDir(), RetryInterval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, err = client.POSTNetContext(context.Background(), &ServerResponse{FullPath: ts.URL + "/report"}, "n=1")
+	if !errors.Is(err, ErrQueued) {
+		t.Fatalf("POSTNetContext() error = %v, want %v", err, ErrQueued)
+	}
+	// 重新发送时平台仍然离线，上报留在队列中
+	if err := client.FlushQueue(context.Background()); err == nil || !queueable(err) {
+		t.Fatalf("FlushQueue() error = %v, want gateway error", err)
+	}
+	if stats := client.QueueStats(); stats.Depth != 1 || stats.Dropped["rejected"] != 0 {
+		t.Fatalf("stats = %+v, want 1 left", stats)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	if err := client.FlushQueue(context.Background()); err != nil {
+		t.Fatalf("FlushQueue() error = %v", err)
+	}
+	if stats := client.QueueStats(); stats.Depth != 0 || atomic.LoadInt32(&received) != 1 {
+		t.Errorf("stats = %+v received = %d, want replayed", stats, received)
+	}
+}
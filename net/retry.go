@@ -0,0 +1,99 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy 请求重试策略
+// GET 请求默认按策略重试，POST 等请求需要 ServerResponse.Retry 为 true
+type RetryPolicy struct {
+	MaxAttempts int           // 最大请求次数，包含第一次请求，小于 2 不重试
+	BaseDelay   time.Duration // 第一次重试前等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 最大等待时间，0 不限制
+	Jitter      float64       // 随机抖动比例 0-1，避免大量设备同时重试
+
+	RetryTransport bool  // 网络错误，超时等没有得到响应的请求
+	Retry5xx       bool  // http 状态码 5xx
+	RetryCodes     []int // 返回内容中需要重试的 code
+}
+
+// DefaultRetryPolicy 网络错误和 5xx 最多请求 3 次
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		BaseDelay:      500 * time.Millisecond,
+		MaxDelay:       5 * time.Second,
+		Jitter:         0.2,
+		RetryTransport: true,
+		Retry5xx:       true,
+	}
+}
+
+// shouldRetry status 为 0 且 err 不为空表示请求没有得到响应
+func (p *RetryPolicy) shouldRetry(status, code int, err error) bool {
+	if status == 0 {
+		return err != nil && p.RetryTransport
+	}
+	if status >= http.StatusInternalServerError {
+		return p.Retry5xx
+	}
+	if err != nil {
+		return false
+	}
+	for _, c := range p.RetryCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * p.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay
+}
+
+// withRetry 执行 fn，按重试策略重复执行，fn 返回 http 状态码，返回内容中的 code 和错误
+func (n *Client) withRetry(ctx context.Context, method string, sr *ServerResponse, fn func() (int, int, error)) error {
+	p := n.Config.Retry
+	if p == nil || p.MaxAttempts < 2 || (method != http.MethodGet && !sr.Retry) {
+		_, _, err := fn()
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		status, code, err := fn()
+		if attempt >= p.MaxAttempts || !p.shouldRetry(status, code, err) || ctx.Err() != nil || errors.Is(err, errBodyConsumed) || errors.Is(err, ErrCircuitOpen) {
+			return err
+		}
+
+		t := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Retry(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5, Retry5xx: true}
+	client := &Client{Config: &Config{TimeOver: 5, TimeOut: 5, Retry: policy}}
+
+	tests := []struct {
+		name     string
+		method   string
+		retry    bool
+		wantHits int
+		wantErr  bool
+	}{
+		{name: "GET 默认重试", method: http.MethodGet, wantHits: 3},
+		{name: "POST 未开启重试", method: http.MethodPost, wantHits: 1, wantErr: true},
+		{name: "POST 开启重试", method: http.MethodPost, retry: true, wantHits: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits = 0
+			sr := &ServerResponse{FullPath: ts.URL, Retry: tt.retry, ResponseInfo: &ResponseInfo{}}
+			var err error
+			if tt.method == http.MethodGet {
+				_, err = client.GetNet(sr)
+			} else {
+				_, err = client.POSTNet(sr, "a=b")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hits != tt.wantHits {
+				t.Errorf("hits = %d, want %d", hits, tt.wantHits)
+			}
+		})
+	}
+}
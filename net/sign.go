@@ -0,0 +1,171 @@
+package net
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 签名请求头
+const (
+	HeaderAppid         = "X-Appid"
+	HeaderTimestamp     = "X-Timestamp"
+	HeaderNonce         = "X-Nonce"
+	HeaderContentSha256 = "X-Content-Sha256"
+	HeaderSignature     = "X-Signature"
+
+	// UnsignedPayload 流式上传无法提前计算请求内容 hash，签名不包含请求内容
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+var (
+	// ErrSignature 签名缺失或不正确
+	ErrSignature = errors.New("签名错误")
+	// ErrSignatureExpired 签名时间超出允许范围
+	ErrSignatureExpired = errors.New("签名已过期")
+	// ErrUnsignedPayload 请求内容没有签名，VerifyPolicy.AllowUnsignedPayload 为 false 时拒绝
+	ErrUnsignedPayload = errors.New("请求内容没有签名")
+)
+
+// VerifyPolicy 服务端校验签名的选项
+type VerifyPolicy struct {
+	MaxSkew time.Duration // 允许的时间误差，0 表示不校验时间
+	// AllowUnsignedPayload 接受请求内容 hash 为 UnsignedPayload 的流式上传，默认拒绝，
+	// 此时请求内容不受签名保护，截获的请求可以替换内容后重放，调用方必须记录 nonce 拒绝重复的请求
+	AllowUnsignedPayload bool
+}
+
+// signInterceptor 使用 Appid/AppSecret 对请求签名
+func (n *Client) signInterceptor(call *Call, next Handler) error {
+	req := call.Request
+	bodyHash, err := requestBodyHash(req)
+	if err != nil {
+		return err
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set(HeaderAppid, n.Config.Appid)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContentSha256, bodyHash)
+	req.Header.Set(HeaderSignature, signature(n.Config.AppSecret, req, n.Config.Appid, timestamp, nonce, bodyHash))
+	return next(call)
+}
+
+// Verify 校验请求签名，maxSkew 为允许的时间误差，0 表示不校验时间，
+// 拒绝请求内容 hash 为 UnsignedPayload 的请求，nonce 是否重复由调用方判断
+func Verify(r *http.Request, secret string, maxSkew time.Duration) error {
+	p := &VerifyPolicy{MaxSkew: maxSkew}
+	return p.Verify(r, secret)
+}
+
+// Verify 按 VerifyPolicy 校验请求签名，nonce 是否重复由调用方判断
+func (p *VerifyPolicy) Verify(r *http.Request, secret string) error {
+	appid := r.Header.Get(HeaderAppid)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	bodyHash := r.Header.Get(HeaderContentSha256)
+	sign := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || bodyHash == "" || sign == "" {
+		return ErrSignature
+	}
+
+	if p.MaxSkew > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrSignature
+		}
+		skew := time.Since(time.Unix(ts, 0))
+		if skew > p.MaxSkew || skew < -p.MaxSkew {
+			return ErrSignatureExpired
+		}
+	}
+
+	if bodyHash == UnsignedPayload && !p.AllowUnsignedPayload {
+		return ErrUnsignedPayload
+	}
+	if bodyHash != UnsignedPayload {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				return err
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if hashHex(body) != bodyHash {
+			return ErrSignature
+		}
+	}
+
+	want := signature(secret, r, appid, timestamp, nonce, bodyHash)
+	if !hmac.Equal([]byte(want), []byte(sign)) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// signature 签名内容为 method，path，按 key 排序的 query，appid，timestamp，nonce 和请求内容 hash，以换行分隔
+func signature(secret string, r *http.Request, appid, timestamp, nonce, bodyHash string) string {
+	content := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		appid,
+		timestamp,
+		nonce,
+		bodyHash,
+	}, "\n")
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestBodyHash 请求内容的 sha256，不能重复读取的请求内容返回 UnsignedPayload
+func requestBodyHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+	if req.GetBody == nil {
+		return UnsignedPayload, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, body)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,67 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Sign(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verify := &VerifyPolicy{MaxSkew: time.Minute, AllowUnsignedPayload: r.URL.Path == "/upload"}
+		if err := verify.Verify(r, "secret"); err != nil {
+			fmt.Fprintf(w, `{"code":403,"message":"%s"}`, err)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	client, err := New(&Config{Appid: "sign", AppSecret: "secret", Sign: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		send func() error
+	}{
+		{name: "GET", send: func() error {
+			_, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/report?b=2&a=1"})
+			return err
+		}},
+		{name: "POST", send: func() error {
+			_, err := client.POSTNet(&ServerResponse{FullPath: ts.URL + "/report"}, "fault_data=1")
+			return err
+		}},
+		{name: "流式上传", send: func() error {
+			_, err := client.UploadParts(context.Background(), &ServerResponse{FullPath: ts.URL + "/upload"}, []Part{
+				{Name: "file", FileName: "a.txt", Reader: strings.NewReader("content")},
+			}, nil)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.send(); err != nil {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+
+	// 没有 AllowUnsignedPayload 时拒绝不包含请求内容的签名
+	_, err = client.UploadParts(context.Background(), &ServerResponse{FullPath: ts.URL + "/report"}, []Part{
+		{Name: "file", FileName: "a.txt", Reader: strings.NewReader("content")},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), ErrUnsignedPayload.Error()) {
+		t.Errorf("UploadParts() error = %v, want %v", err, ErrUnsignedPayload)
+	}
+
+	client.Config.AppSecret = "wrong"
+	if _, err := client.POSTNet(&ServerResponse{FullPath: ts.URL + "/report"}, "a=1"); err == nil {
+		t.Errorf("POSTNet() with wrong secret should fail")
+	}
+}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"net/http"
+	"time"
 )
 
 type TokenClient interface {
@@ -12,3 +13,15 @@ type TokenClient interface {
 	GetCacheToken() string
 	Ping() error
 }
+
+// CookieStore TokenClient 可选实现，保存 CookieJar 的 cookie，重启后继续使用
+type CookieStore interface {
+	SetCookies(data []byte)
+	GetCookies() []byte
+}
+
+// TokenExpirer TokenClient 可选实现，保存 token 过期时间，用于过期前提前刷新
+type TokenExpirer interface {
+	SetCacheTokenExpire(expireAt time.Time)
+	GetCacheTokenExpire() time.Time
+}
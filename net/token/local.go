@@ -9,12 +9,10 @@ import (
 	"github.com/patrickmn/go-cache"
 )
 
-var oncela sync.Once
-
 type LocalClient struct {
 	AppID   string
+	once    sync.Once
 	rw      sync.RWMutex
-	token   string
 	ca      *cache.Cache
 	phpsess *http.Cookie
 }
@@ -22,12 +20,17 @@ type LocalClient struct {
 func (lc *LocalClient) SetSessionId(cookies []*http.Cookie) {
 	for _, cookie := range cookies {
 		if cookie.Name == "PHPSESSID" {
+			lc.rw.Lock()
+			lc.phpsess = nil
+			lc.rw.Unlock()
 			lc.ca.Set(fmt.Sprintf("PHPSESSIONID_%s", lc.AppID), cookie, cache.DefaultExpiration)
 		}
 	}
 }
 
 func (lc *LocalClient) GetSessionId() *http.Cookie {
+	lc.rw.Lock()
+	defer lc.rw.Unlock()
 	if lc.phpsess != nil {
 		return lc.phpsess
 	}
@@ -38,8 +41,20 @@ func (lc *LocalClient) GetSessionId() *http.Cookie {
 	return lc.phpsess
 }
 
+func (lc *LocalClient) SetCookies(data []byte) {
+	lc.ca.Set("Cookies:"+lc.AppID, data, cache.DefaultExpiration)
+}
+
+func (lc *LocalClient) GetCookies() []byte {
+	foo, found := lc.ca.Get("Cookies:" + lc.AppID)
+	if !found {
+		return nil
+	}
+	return foo.([]byte)
+}
+
 func (lc *LocalClient) GetCache() {
-	oncela.Do(func() {
+	lc.once.Do(func() {
 		lc.ca = cache.New(24*time.Hour, 7*24*time.Hour)
 	})
 
@@ -55,10 +70,22 @@ func (lc *LocalClient) GetCacheToken() string {
 	lc.rw.RLock()
 	defer lc.rw.RUnlock()
 	foo, found := lc.ca.Get("XToken:" + lc.AppID)
-	if found {
-		lc.token = foo.(string)
+	if !found {
+		return ""
+	}
+	return foo.(string)
+}
+
+func (lc *LocalClient) SetCacheTokenExpire(expireAt time.Time) {
+	lc.ca.Set("XTokenExpire:"+lc.AppID, expireAt, cache.DefaultExpiration)
+}
+
+func (lc *LocalClient) GetCacheTokenExpire() time.Time {
+	foo, found := lc.ca.Get("XTokenExpire:" + lc.AppID)
+	if !found {
+		return time.Time{}
 	}
-	return lc.token
+	return foo.(time.Time)
 }
 
 func (lc *LocalClient) Ping() error {
@@ -2,52 +2,78 @@ package token
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
-	"github.com/chindeo/pkg/net/redis_client"
 	"github.com/go-redis/redis/v8"
 	"github.com/patrickmn/go-cache"
 )
 
-var (
-	onceLc sync.Once
-)
-
 type RedisClient struct {
 	AppID   string
 	Host    string
 	Pwd     string
+	once    sync.Once
 	rw      sync.RWMutex
-	token   string
 	ca      *redis.Client
 	phpsess *http.Cookie
 }
 
+// SetSessionId cookie 以 json 格式保存
 func (lc *RedisClient) SetSessionId(cookies []*http.Cookie) {
 	for _, cookie := range cookies {
 		if cookie.Name == "PHPSESSID" {
-			lc.ca.Set(context.Background(), fmt.Sprintf("PHPSESSIONID_%s", lc.AppID), cookie, cache.DefaultExpiration)
+			b, err := json.Marshal(cookie)
+			if err != nil {
+				continue
+			}
+			lc.rw.Lock()
+			lc.phpsess = nil
+			lc.rw.Unlock()
+			lc.ca.Set(context.Background(), fmt.Sprintf("PHPSESSIONID_%s", lc.AppID), b, cache.DefaultExpiration)
 		}
 	}
 }
 
 func (lc *RedisClient) GetSessionId() *http.Cookie {
-	if lc.phpsess != nil {
-		return lc.phpsess
+	lc.rw.RLock()
+	phpsess := lc.phpsess
+	lc.rw.RUnlock()
+	if phpsess != nil {
+		return phpsess
 	}
-	var hc *http.Cookie
-	err := lc.ca.Get(context.Background(), fmt.Sprintf("PHPSESSIONID_%s", lc.AppID)).Scan(hc)
+	b, err := lc.ca.Get(context.Background(), fmt.Sprintf("PHPSESSIONID_%s", lc.AppID)).Bytes()
 	if err != nil {
-		lc.phpsess = hc
+		return nil
 	}
-	return lc.phpsess
+	hc := &http.Cookie{}
+	if json.Unmarshal(b, hc) != nil {
+		return nil
+	}
+	lc.rw.Lock()
+	lc.phpsess = hc
+	lc.rw.Unlock()
+	return hc
+}
+
+func (lc *RedisClient) SetCookies(data []byte) {
+	lc.ca.Set(context.Background(), "Cookies:"+lc.AppID, data, cache.DefaultExpiration)
+}
+
+func (lc *RedisClient) GetCookies() []byte {
+	b, err := lc.ca.Get(context.Background(), "Cookies:"+lc.AppID).Bytes()
+	if err != nil {
+		return nil
+	}
+	return b
 }
 
 func (lc *RedisClient) GetCache() {
-	onceLc.Do(func() {
-		lc.ca = redis_client.NewClient(&redis.Options{
+	lc.once.Do(func() {
+		lc.ca = redis.NewClient(&redis.Options{
 			Addr:     lc.Host,
 			Password: lc.Pwd, // no password set
 			DB:       0,      // use default DB
@@ -67,10 +93,25 @@ func (lc *RedisClient) GetCacheToken() string {
 	defer lc.rw.RUnlock()
 	foo, err := lc.ca.Get(context.Background(), "XToken:"+lc.AppID).Result()
 	if err != nil {
-		lc.token = ""
+		return ""
+	}
+	return foo
+}
+
+func (lc *RedisClient) SetCacheTokenExpire(expireAt time.Time) {
+	var unix int64
+	if !expireAt.IsZero() {
+		unix = expireAt.Unix()
+	}
+	lc.ca.Set(context.Background(), "XTokenExpire:"+lc.AppID, unix, cache.DefaultExpiration)
+}
+
+func (lc *RedisClient) GetCacheTokenExpire() time.Time {
+	unix, err := lc.ca.Get(context.Background(), "XTokenExpire:"+lc.AppID).Int64()
+	if err != nil || unix == 0 {
+		return time.Time{}
 	}
-	lc.token = foo
-	return lc.token
+	return time.Unix(unix, 0)
 }
 
 func (lc *RedisClient) Ping() error {
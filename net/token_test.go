@@ -0,0 +1,182 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/token"
+)
+
+func Test_TokenSingleFlight(t *testing.T) {
+	var logins, refreshes int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"fresh","ExpiresIn":7200}}`)
+	})
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"refreshed","ExpiresIn":7200}}`)
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Token") {
+		case "fresh", "refreshed":
+			fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+		default:
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &Client{
+		Config:      &Config{Appid: "flight", LoginUrl: ts.URL + "/login", RefreshUrl: ts.URL + "/refresh"},
+		TokenClient: &token.LocalClient{AppID: "flight"},
+	}
+	client.TokenClient.GetCache()
+	client.TokenClient.SetCacheToken("stale")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/data", Auth: true}); err != nil {
+				t.Errorf("GetNet() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if logins != 1 {
+		t.Errorf("logins = %d, want 1", logins)
+	}
+	if expire := client.tokenExpire(); time.Until(expire) < time.Hour {
+		t.Errorf("token expire = %s, want about 2 hours later", expire)
+	}
+
+	// 进入提前刷新时间
+	client.TokenClient.(token.TokenExpirer).SetCacheTokenExpire(time.Now().Add(30 * time.Second))
+	if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/data", Auth: true}); err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if refreshes != 1 || client.TokenClient.GetCacheToken() != "refreshed" {
+		t.Errorf("refreshes = %d token = %s, want proactive refresh", refreshes, client.TokenClient.GetCacheToken())
+	}
+}
+
+func Test_TokenFlightPerClient(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"fresh","ExpiresIn":7200}}`)
+	}))
+	defer ts.Close()
+
+	newClient := func() *Client {
+		client := &Client{
+			Config:      &Config{Appid: "flight", LoginUrl: ts.URL + "/login"},
+			TokenClient: &token.LocalClient{AppID: "flight"},
+		}
+		client.TokenClient.GetCache()
+		return client
+	}
+	a, b := newClient(), newClient()
+
+	var wg sync.WaitGroup
+	for _, client := range []*Client{a, b} {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			if _, err := client.login(context.Background()); err != nil {
+				t.Errorf("login() error = %v", err)
+			}
+		}(client)
+	}
+
+	// 等待中的调用按自己的 ctx 返回
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.login(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting login() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	wg.Wait()
+	for name, client := range map[string]*Client{"a": a, "b": b} {
+		if got := client.TokenClient.GetCacheToken(); got != "fresh" {
+			t.Errorf("client %s token = %q, want fresh", name, got)
+		}
+	}
+}
+
+// basicTokenClient 只实现 token.TokenClient，不保存过期时间和 cookie
+type basicTokenClient struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (c *basicTokenClient) SetSessionId(cookies []*http.Cookie) {}
+func (c *basicTokenClient) GetSessionId() *http.Cookie          { return nil }
+func (c *basicTokenClient) GetCache()                           {}
+func (c *basicTokenClient) Ping() error                         { return nil }
+
+func (c *basicTokenClient) SetCacheToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *basicTokenClient) GetCacheToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func Test_TokenClientWithoutExpire(t *testing.T) {
+	var refreshes int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"fresh","ExpiresIn":1}}`)
+	})
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"refreshed"}}`)
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &Client{
+		Config:      &Config{Appid: "basic", LoginUrl: ts.URL + "/login", RefreshUrl: ts.URL + "/refresh"},
+		TokenClient: &basicTokenClient{},
+	}
+	if _, err := client.login(context.Background()); err != nil {
+		t.Fatalf("login() error = %v", err)
+	}
+	if _, err := client.GetNet(&ServerResponse{FullPath: ts.URL + "/data", Auth: true}); err != nil {
+		t.Fatalf("GetNet() error = %v", err)
+	}
+	if refreshes != 0 || client.TokenClient.GetCacheToken() != "fresh" {
+		t.Errorf("refreshes = %d token = %s, want no proactive refresh", refreshes, client.TokenClient.GetCacheToken())
+	}
+
+	// 没有实现 token.CookieStore 时 cookie 只保存在内存
+	jar := NewCookieJar(client.TokenClient)
+	u, _ := url.Parse(ts.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: "SESSION", Value: "s1"}})
+	if cookies := jar.Cookies(u); len(cookies) != 1 || cookies[0].Value != "s1" {
+		t.Errorf("jar.Cookies() = %v", cookies)
+	}
+}
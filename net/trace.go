@@ -0,0 +1,96 @@
+package net
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// TracePolicy 每次请求创建一个 client span，ctx 中有 span 时作为父 span，
+// span 通过 Tracer.Inject 和 W3C traceparent 请求头传给平台
+type TracePolicy struct {
+	Tracer opentracing.Tracer // 为空时使用 opentracing.GlobalTracer()
+}
+
+func (p *TracePolicy) tracer() opentracing.Tracer {
+	if p.Tracer != nil {
+		return p.Tracer
+	}
+	return opentracing.GlobalTracer()
+}
+
+// traceInterceptor 在内置拦截器的最外层创建 span，重试时每次请求单独创建，
+// 之后的拦截器和 logging.For 通过请求的 ctx 读取这个 span
+func (n *Client) traceInterceptor(call *Call, next Handler) error {
+	tracer := n.Config.Trace.tracer()
+	req := call.Request
+	ctx := req.Context()
+
+	opts := []opentracing.StartSpanOption{ext.SpanKindRPCClient}
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := tracer.StartSpan("HTTP "+req.Method, opts...)
+	defer span.Finish()
+
+	ext.HTTPMethod.Set(span, req.Method)
+	ext.HTTPUrl.Set(span, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	ext.PeerHostname.Set(span, req.URL.Hostname())
+
+	_ = tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+	if traceparent := traceparent(span.Context()); traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+	call.Request = req.WithContext(opentracing.ContextWithSpan(ctx, span))
+
+	err := next(call)
+	if status := call.StatusCode(); status != 0 {
+		ext.HTTPStatusCode.Set(span, uint16(status))
+	}
+	if call.Result != nil {
+		span.SetTag("envelope.code", call.Result.Code)
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "message", err.Error())
+	}
+	return err
+}
+
+// traceparent 按 W3C Trace Context 格式输出 span，
+// 与 logging.For 一样从 span.Context() 的 "traceid:spanid:parentid:flags" 格式读取，无法读取时返回空
+func traceparent(sc opentracing.SpanContext) string {
+	parts := strings.Split(fmt.Sprintf("%s", sc), ":")
+	if len(parts) != 4 {
+		return ""
+	}
+	traceID, spanID := parts[0], parts[1]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) {
+		return ""
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return ""
+	}
+	traceID = strings.Repeat("0", 32-len(traceID)) + strings.ToLower(traceID)
+	spanID = strings.Repeat("0", 16-len(spanID)) + strings.ToLower(spanID)
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", traceID, spanID, flags&1)
+}
+
+func isHex(s string, max int) bool {
+	if s == "" || len(s) > max {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
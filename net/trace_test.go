@@ -0,0 +1,77 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func Test_Trace(t *testing.T) {
+	var traceID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = r.Header.Get("Mockpfx-Ids-Traceid")
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	client, err := New(&Config{Trace: &TracePolicy{Tracer: tracer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := tracer.StartSpan("report")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	if _, err := client.GetNetContext(ctx, &ServerResponse{FullPath: ts.URL + "/report?a=1"}); err != nil {
+		t.Fatalf("GetNetContext() error = %v", err)
+	}
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("finished spans = %d, want 2", len(spans))
+	}
+	span, parentContext := spans[0], parent.Context().(mocktracer.MockSpanContext)
+	if span.ParentID != parentContext.SpanID {
+		t.Errorf("span parent = %d, want %d", span.ParentID, parentContext.SpanID)
+	}
+	if traceID != strconv.Itoa(parentContext.TraceID) {
+		t.Errorf("injected trace id = %s, want %d", traceID, parentContext.TraceID)
+	}
+	if span.OperationName != "HTTP GET" || span.Tag("http.url") != ts.URL+"/report" || span.Tag("http.status_code") != uint16(200) || span.Tag("envelope.code") != 200 {
+		t.Errorf("span = %s %v", span.OperationName, span.Tags())
+	}
+}
+
+type stringSpanContext string
+
+func (s stringSpanContext) ForeachBaggageItem(handler func(k, v string) bool) {}
+
+func (s stringSpanContext) String() string {
+	return string(s)
+}
+
+func Test_Traceparent(t *testing.T) {
+	tests := []struct {
+		sc   string
+		want string
+	}{
+		{sc: "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1", want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{sc: "a3ce929d0e0e4736:f067aa0ba902b7:1:0", want: "00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{sc: "0:0:0:1", want: ""},
+		{sc: "not-a-span", want: ""},
+		{sc: "xyz:1:0:1", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sc, func(t *testing.T) {
+			if got := traceparent(stringSpanContext(tt.sc)); got != tt.want {
+				t.Errorf("traceparent() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
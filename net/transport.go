@@ -0,0 +1,116 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TransportOptions 连接池和 TLS 设置，0 值使用 http.DefaultTransport 的设置
+type TransportOptions struct {
+	MaxIdleConns          int           // 所有主机的最大空闲连接数
+	MaxIdleConnsPerHost   int           // 每个主机的最大空闲连接数
+	MaxConnsPerHost       int           // 每个主机的最大连接数
+	IdleConnTimeout       time.Duration // 空闲连接保持时间
+	DialTimeout           time.Duration // 建立连接超时
+	KeepAlive             time.Duration // tcp keep-alive 间隔
+	TLSHandshakeTimeout   time.Duration // TLS 握手超时
+	ResponseHeaderTimeout time.Duration // 发送请求后等待返回 header 的超时
+
+	CAFile             string // 自定义 CA 证书文件，PEM 格式，添加到系统证书中
+	CertFile           string // mTLS 客户端证书
+	KeyFile            string // mTLS 客户端私钥
+	ServerName         string // 校验证书使用的主机名，为空使用请求的主机名
+	InsecureSkipVerify bool   // 跳过证书校验，只用于测试环境
+}
+
+// newTransport 每个 Client 使用一个 Transport，复用连接
+func newTransport(cfg *Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 添加代理，没有匹配的规则时使用环境变量中的代理
+	proxy, err := proxyFunc(cfg, transport.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	opt := cfg.Transport
+	if opt == nil {
+		return transport, nil
+	}
+
+	if opt.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opt.MaxIdleConns
+	}
+	if opt.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opt.MaxIdleConnsPerHost
+	}
+	if opt.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opt.MaxConnsPerHost
+	}
+	if opt.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opt.IdleConnTimeout
+	}
+	if opt.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opt.TLSHandshakeTimeout
+	}
+	if opt.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = opt.ResponseHeaderTimeout
+	}
+	if opt.DialTimeout > 0 || opt.KeepAlive > 0 {
+		dialer := &stdnet.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if opt.DialTimeout > 0 {
+			dialer.Timeout = opt.DialTimeout
+		}
+		if opt.KeepAlive > 0 {
+			dialer.KeepAlive = opt.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	tlsConfig, err := opt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+func (opt *TransportOptions) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         opt.ServerName,
+		InsecureSkipVerify: opt.InsecureSkipVerify,
+	}
+
+	if opt.CAFile != "" {
+		pem, err := os.ReadFile(opt.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file %s %w", opt.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca file %s has no valid certificate", opt.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, errors.New("mTLS need both CertFile and KeyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,51 @@
+package net
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Transport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"message":"ok"}`)
+	}))
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options *TransportOptions
+		wantErr bool
+	}{
+		{name: "默认证书校验失败", options: nil, wantErr: true},
+		{name: "自定义 CA", options: &TransportOptions{CAFile: caFile, MaxIdleConnsPerHost: 4, DialTimeout: time.Second}},
+		{name: "跳过校验", options: &TransportOptions{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(&Config{Transport: tt.options, TimeOut: 5})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			_, err = client.GetNet(&ServerResponse{FullPath: ts.URL})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetNet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := New(&Config{Transport: &TransportOptions{CertFile: caFile}}); err == nil {
+		t.Errorf("New() with CertFile only should return error")
+	}
+}
@@ -0,0 +1,163 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errBodyConsumed 请求内容不能重复读取，不能重试和重放
+var errBodyConsumed = errors.New("请求内容已读取，不能重复发送")
+
+// Part multipart 表单字段，Path 或 Reader 不为空时作为文件上传，否则作为普通字段
+type Part struct {
+	Name        string    // 字段名
+	Value       string    // 普通字段值
+	FileName    string    // 文件名，为空时使用 Path 的文件名
+	Path        string    // 文件路径，每次发送都会重新打开，支持重试和重放
+	Reader      io.Reader // 文件内容，实现 io.Seeker 时支持重试和重放
+	Size        int64     // Reader 内容大小，用于计算进度，0 表示未知
+	ContentType string    // 文件类型，默认 application/octet-stream
+}
+
+func (p *Part) isFile() bool {
+	return p.Path != "" || p.Reader != nil
+}
+
+// UploadParts 流式上传多个文件和字段，请求内容通过 io.Pipe 边读边发，不会读入内存
+// 上传不受 TimeOver/TimeOut 限制，使用 ctx 控制取消和超时，progress 只统计文件内容
+func (n *Client) UploadParts(ctx context.Context, sr *ServerResponse, parts []Part, progress Progress) ([]byte, error) {
+	total, err := partsSize(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	opened := 0
+	body := &requestBody{
+		contentType: "multipart/form-data; boundary=" + boundary,
+		stream:      true,
+	}
+	body.open = func() (io.Reader, error) {
+		opened++
+		if opened > 1 {
+			for i := range parts {
+				if err := parts[i].rewind(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeParts(pw, boundary, parts, total, progress))
+		}()
+		return pr, nil
+	}
+	return n.send(ctx, http.MethodPost, sr, body)
+}
+
+// rewind 重新发送前将 Reader 移到开头
+func (p *Part) rewind() error {
+	if p.Reader == nil {
+		return nil
+	}
+	seeker, ok := p.Reader.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("%s %w", p.Name, errBodyConsumed)
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// partsSize 文件内容总大小，存在未知大小的文件时返回 -1
+func partsSize(parts []Part) (int64, error) {
+	var total int64
+	for _, p := range parts {
+		switch {
+		case p.Path != "":
+			fi, err := os.Stat(p.Path)
+			if err != nil {
+				return 0, err
+			}
+			total += fi.Size()
+		case p.Reader != nil:
+			if p.Size <= 0 {
+				return -1, nil
+			}
+			total += p.Size
+		}
+	}
+	return total, nil
+}
+
+func writeParts(w io.Writer, boundary string, parts []Part, total int64, progress Progress) error {
+	writer := multipart.NewWriter(w)
+	err := writer.SetBoundary(boundary)
+	if err != nil {
+		return err
+	}
+
+	var done int64
+	for i := range parts {
+		p := &parts[i]
+		if !p.isFile() {
+			err = writer.WriteField(p.Name, p.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		part, err := writer.CreatePart(p.header())
+		if err != nil {
+			return err
+		}
+		written, err := p.copyTo(part, done, total, progress)
+		done += written
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func (p *Part) header() textproto.MIMEHeader {
+	filename := p.FileName
+	if filename == "" {
+		filename = filepath.Base(p.Path)
+	}
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(p.Name), escapeQuotes(filename)))
+	h.Set("Content-Type", contentType)
+	return h
+}
+
+func (p *Part) copyTo(w io.Writer, done, total int64, progress Progress) (int64, error) {
+	src := p.Reader
+	if p.Path != "" {
+		f, err := os.Open(p.Path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		src = f
+	}
+	return copyProgress(w, src, done, total, progress)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,111 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chindeo/pkg/net/token"
+)
+
+func Test_UploadParts(t *testing.T) {
+	var uploads int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200,"message":"ok","data":{"AccessToken":"token"}}`)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		if r.Header.Get("X-Token") != "token" {
+			fmt.Fprint(w, `{"code":401,"message":"login again"}`)
+			return
+		}
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			fmt.Fprintf(w, `{"code":500,"message":%q}`, err.Error())
+			return
+		}
+		var got []string
+		for _, name := range []string{"log", "image"} {
+			file, header, err := r.FormFile(name)
+			if err != nil {
+				fmt.Fprintf(w, `{"code":500,"message":%q}`, err.Error())
+				return
+			}
+			b, _ := io.ReadAll(file)
+			file.Close()
+			got = append(got, header.Filename+":"+string(b))
+		}
+		got = append(got, r.FormValue("device"))
+		fmt.Fprintf(w, `{"code":200,"message":"ok","data":%q}`, strings.Join(got, ","))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "nis.log")
+	if err := os.WriteFile(path, []byte("log content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		Config:      &Config{Appid: "upload", LoginUrl: ts.URL + "/login"},
+		TokenClient: &token.LocalClient{AppID: "upload"},
+	}
+	client.TokenClient.GetCache()
+
+	var transferred, total int64
+	sr := &ServerResponse{FullPath: ts.URL + "/upload", Auth: true, ResponseInfo: &ResponseInfo{}}
+	_, err := client.UploadParts(context.Background(), sr, []Part{
+		{Name: "log", Path: path},
+		{Name: "image", FileName: "a.png", Reader: strings.NewReader("png"), Size: 3},
+		{Name: "device", Value: "bed-01"},
+	}, func(n, size int64) {
+		transferred, total = n, size
+	})
+	if err != nil {
+		t.Fatalf("UploadParts() error = %v", err)
+	}
+	if want := "nis.log:log content,a.png:png,bed-01"; sr.ResponseInfo.Data != want {
+		t.Errorf("UploadParts() data = %v, want %s", sr.ResponseInfo.Data, want)
+	}
+	if uploads != 2 {
+		t.Errorf("UploadParts() uploads = %d, want 2", uploads)
+	}
+	if transferred != 14 || total != 14 {
+		t.Errorf("progress = %d/%d, want 14/14", transferred, total)
+	}
+}
+
+func Test_UploadPartsShortCircuit(t *testing.T) {
+	rejected := errors.New("rejected")
+	client := &Client{Config: &Config{
+		Interceptors: []Interceptor{func(call *Call, next Handler) error { return rejected }},
+	}}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, err := client.UploadParts(context.Background(), &ServerResponse{FullPath: "http://127.0.0.1/upload"}, []Part{
+			{Name: "log", FileName: "nis.log", Reader: strings.NewReader(strings.Repeat("log", 64<<10))},
+		}, nil)
+		if !errors.Is(err, rejected) {
+			t.Fatalf("UploadParts() error = %v, want %v", err, rejected)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines = %d, want <= %d", n, before)
+	}
+}